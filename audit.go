@@ -0,0 +1,65 @@
+package DBF
+
+import (
+	"crypto/sha512"
+	"sync"
+)
+
+// auditLog holds the fingerprints of the added elements in order, guarded for AtomicDistBF and
+// AddBatchParallel, which add from several goroutines
+type auditLog struct {
+	mu           sync.Mutex
+	fingerprints [][sha512.Size256]byte
+}
+
+// WithAudit records the ElementFingerprint of every added element in order, returned by AuditLog, to
+// reconstruct what went into DBFs that peers disagree on. It keeps 32 bytes per add, duplicates included,
+// so it is meant for debugging.
+func WithAudit() Option {
+	return func(dbf *DistBF) {
+		dbf.audit = new(auditLog)
+	}
+}
+
+// AuditLog returns a copy of the fingerprints recorded by WithAudit since DBF was created, last cleared or
+// decoded into, one per added element in the order they were added, nil without WithAudit. Elements added
+// concurrently through AtomicDistBF are in the order their adds recorded them.
+func (dbf *DistBF) AuditLog() [][sha512.Size256]byte {
+	if dbf.audit == nil {
+		return nil
+	}
+	dbf.audit.mu.Lock()
+	defer dbf.audit.mu.Unlock()
+	return append([][sha512.Size256]byte{}, dbf.audit.fingerprints...)
+}
+
+// auditAdds records the fingerprints of added elements
+func (dbf *DistBF) auditAdds(fingerprints ...[sha512.Size256]byte) {
+	if dbf.audit == nil {
+		return
+	}
+	dbf.audit.mu.Lock()
+	dbf.audit.fingerprints = append(dbf.audit.fingerprints, fingerprints...)
+	dbf.audit.mu.Unlock()
+}
+
+// auditAdd records the fingerprint of the added element with the given hash
+func (dbf *DistBF) auditAdd(digest []byte) {
+	if dbf.audit != nil {
+		dbf.auditAdds(dbf.digestFingerprint(digest))
+	}
+}
+
+// resetAudit empties the audit log
+func (dbf *DistBF) resetAudit() {
+	if dbf.audit != nil {
+		dbf.audit = new(auditLog)
+	}
+}
+
+// clone returns an independent copy of the audit log
+func (a *auditLog) clone() *auditLog {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return &auditLog{fingerprints: append([][sha512.Size256]byte(nil), a.fingerprints...)}
+}
@@ -0,0 +1,59 @@
+package DBF
+
+import (
+	"bytes"
+	"crypto/sha512"
+	"reflect"
+	"testing"
+)
+
+func TestWithAudit(t *testing.T) {
+	dbf := NewDbfWithOptions(1000, 0.01, WithSeed([]byte("seed")), WithAudit())
+	elements := batchElements(20)
+	dbf.Add(elements[0])
+	dbf.AddString(string(elements[1]))
+	dbf.AddBatch(elements[2:10])
+	if err := dbf.AddReader(bytes.NewReader(elements[10])); err != nil {
+		t.Fatal(err)
+	}
+	dbf.AddBatchParallel(elements[11:19], 3)
+	dbf.Add(elements[0])
+	var want [][sha512.Size256]byte
+	for _, elem := range append(elements[:19:19], elements[0]) {
+		want = append(want, dbf.ElementFingerprint(elem))
+	}
+	if !reflect.DeepEqual(dbf.AuditLog(), want) {
+		t.Fatal("the audit log should hold a fingerprint per add in order")
+	}
+
+	log := dbf.AuditLog()
+	log[0] = [sha512.Size256]byte{}
+	clone := dbf.Clone()
+	clone.Add([]byte("clone only"))
+	if !reflect.DeepEqual(dbf.AuditLog(), want) || len(clone.AuditLog()) != len(want)+1 {
+		t.Fatal("the audit log should not be shared with copies or clones")
+	}
+	atomic := NewAtomicDbf(clone)
+	atomic.Add([]byte("atomic"))
+	if got := clone.AuditLog(); got[len(got)-1] != clone.ElementFingerprint([]byte("atomic")) {
+		t.Fatal("adds through AtomicDistBF should be audited")
+	}
+	dbf.Clear()
+	if len(dbf.AuditLog()) != 0 {
+		t.Fatal("clearing should empty the audit log")
+	}
+	dbf.Add(elements[0])
+	data, err := NewDbf(1000, 0.01, []byte("seed")).MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := dbf.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	if len(dbf.AuditLog()) != 0 {
+		t.Fatal("decoding should empty the audit log")
+	}
+	if NewDbf(1000, 0.01, []byte("seed")).AuditLog() != nil {
+		t.Fatal("without WithAudit the audit log should be nil")
+	}
+}
@@ -3,25 +3,120 @@ package DBF
 import (
 	"bytes"
 	"crypto/sha512"
+	"encoding/binary"
 	"encoding/gob"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
 	"math"
+	"math/bits"
+	"sync"
 
 	"github.com/willf/bitset"
 )
 
-// DistBF is the dbf struct
+// DistBF is the dbf struct, the m bits are packed into 64 bit words so it takes about m/8 bytes.
+// Elements passed to its methods are only read during the call, never modified or retained, so callers can
+// pass subslices of a buffer they reuse afterwards.
 type DistBF struct {
-	b *bitset.BitSet
-	m uint
-	k uint
-	h [][sha512.Size256]byte
+	b  *bitset.BitSet
+	m  uint
+	k  uint
+	h  [][]byte
+	s  []byte
+	hf func() hash.Hash
+
+	partitioned bool
+	domain      []byte
+	// littleEndian reads the digest bytes of an index little endian instead of big endian
+	littleEndian bool
+
+	// n is the number of elements the dbf was sized for and fpr the target false positive rate, 0 if not known
+	n   uint
+	fpr float64
+	// maxFill is the fill ratio at which AddChecked stops adding, 0 for no limit
+	maxFill float64
+	// setBits is the number of set bits while setBitsKnown, counted once by AddChecked and then kept up to
+	// date by setLocations until the bits change another way
+	setBits      uint
+	setBitsKnown bool
+	// lazy computes the seed hashes h on first use, it is nil if they are computed upfront
+	lazy *sync.Once
+	// frozen is set by Freeze
+	frozen bool
+	// cache holds the indices of recently used elements, it is nil unless set by WithIndexCache
+	cache *indexCache
+	// summary is the bit array of WithSummary with summaryBits bits, nil if not set or dropped
+	summary     *bitset.BitSet
+	summaryBits uint
+	// stats counts adds and queries, it is nil unless set by WithStats
+	stats *statsCounters
+	// audit records the added elements, it is nil unless set by WithAudit
+	audit *auditLog
 }
 
+var (
+	// ErrFilterFull is returned by AddChecked when the DBF reached its maximum fill ratio
+	ErrFilterFull = errors.New("DBF: filter is full")
+	// ErrFrozen is returned, or panicked with by methods without an error, when modifying a frozen DBF
+	ErrFrozen = errors.New("DBF: filter is frozen")
+)
+
 // NewDbf function return the DBF generated from the sizes of to peers
 func NewDbf(n uint, fpr float64, s []byte) *DistBF {
-	m, k := EstimateParameters(n, fpr)
-	h := seedHashes(s, k)
-	return &DistBF{h: h, m: m, k: k, b: bitset.New(m)}
+	return NewDbfWithOptions(n, fpr, WithSeed(s))
+}
+
+// NewDbfChecked returns the DBF like NewDbf, or an error if n is 0, fpr is not in (0, 1) or the seed is empty
+func NewDbfChecked(n uint, fpr float64, s []byte) (*DistBF, error) {
+	if n == 0 {
+		return nil, errors.New("DBF: n must be greater than 0")
+	}
+	if !(fpr > 0 && fpr < 1) {
+		return nil, fmt.Errorf("DBF: fpr %v must be between 0 and 1", fpr)
+	}
+	if len(s) == 0 {
+		return nil, errors.New("DBF: seed must not be empty")
+	}
+	return NewDbf(n, fpr, s), nil
+}
+
+// NewDbfWithHash returns a DBF like NewDbf that uses hf instead of SHA-512/256 for the seed and element hashes
+func NewDbfWithHash(n uint, fpr float64, s []byte, hf func() hash.Hash) *DistBF {
+	return NewDbfWithOptions(n, fpr, WithSeed(s), WithHash(hf))
+}
+
+// NewDbfWithParams returns the DBF with m bits and k hashes without estimating them, it panics if m or k is 0
+func NewDbfWithParams(m, k uint, s []byte) *DistBF {
+	if m == 0 || k == 0 {
+		panic("DBF: m and k must be greater than 0")
+	}
+	return newDbf(m, k, []Option{WithSeed(s)})
+}
+
+// NewDbfFromBitIndices returns the DBF with m bits and k hashes that has exactly the bits at indices set, as
+// exported by GetBitIndices. It returns an error if m or k is 0 or an index is not below m.
+func NewDbfFromBitIndices(m, k uint, s []byte, indices []uint) (*DistBF, error) {
+	if m == 0 || k == 0 {
+		return nil, errors.New("DBF: m and k must be greater than 0")
+	}
+	dbf := newDbf(m, k, []Option{WithSeed(s)})
+	for _, index := range indices {
+		if index >= m {
+			return nil, fmt.Errorf("DBF: index %d out of range for m=%d", index, m)
+		}
+		dbf.b.Set(index)
+	}
+	return dbf, nil
+}
+
+// hashFunc returns the hash function of DBF, SHA-512/256 if none was set
+func (dbf *DistBF) hashFunc() func() hash.Hash {
+	if dbf.hf == nil {
+		return sha512.New512_256
+	}
+	return dbf.hf
 }
 
 // EstimateParameters estimates requirements for m and k.
@@ -32,46 +127,491 @@ func EstimateParameters(n uint, fpr float64) (m uint, k uint) {
 	return
 }
 
-func xorHash(a, b [sha512.Size256]byte) [sha512.Size256]byte {
-	var c [sha512.Size256]byte
+// EstimateParametersChecked estimates m and k like EstimateParameters, but returns an error for an invalid
+// n or fpr and when m or k do not fit in a uint instead of silently wrapping them
+func EstimateParametersChecked(n uint, fpr float64) (m uint, k uint, err error) {
+	return estimateParametersChecked(n, fpr, bits.UintSize)
+}
+
+// estimateParametersChecked checks m and k against a uint of uintSize bits
+func estimateParametersChecked(n uint, fpr float64, uintSize int) (m uint, k uint, err error) {
+	if n == 0 {
+		return 0, 0, errors.New("DBF: n must be greater than 0")
+	}
+	if !(fpr > 0 && fpr < 1) {
+		return 0, 0, fmt.Errorf("DBF: fpr %v must be between 0 and 1", fpr)
+	}
+	// 2^uintSize is exact in float64 while the maximum uint is not
+	limit := math.Ldexp(1, uintSize)
+	mf := math.Ceil(-1 * float64(n) * math.Log(fpr) / math.Pow(math.Log(2), 2))
+	if mf >= limit {
+		return 0, 0, fmt.Errorf("DBF: m=%v for n=%d and fpr=%v overflows a %d bit uint", mf, n, fpr, uintSize)
+	}
+	kf := math.Ceil(math.Log(2) * mf / float64(n))
+	if kf >= limit {
+		return 0, 0, fmt.Errorf("DBF: k=%v for n=%d and fpr=%v overflows a %d bit uint", kf, n, fpr, uintSize)
+	}
+	return uint(mf), uint(kf), nil
+}
+
+// Capacity returns the maximum number of elements a DBF with m bits and k hashes can hold at the false
+// positive rate fpr, the inverse of EstimateParameters: n = -(m/k) * ln(1 - fpr^(1/k))
+func Capacity(m, k uint, fpr float64) uint {
+	return uint(math.Floor(-float64(m) / float64(k) * math.Log(1-math.Pow(fpr, 1/float64(k)))))
+}
+
+// xorHash xor two digests of equal length, it panics if the lengths differ
+func xorHash(a, b []byte) []byte {
+	if len(a) != len(b) {
+		panic(fmt.Sprintf("DBF: xor of digests with lengths %d and %d", len(a), len(b)))
+	}
+	c := make([]byte, len(a))
 	for i := 0; i < len(a); i++ {
 		c[i] = a[i] ^ b[i]
 	}
 	return c
 }
 
-func seedHashes(seedValue []byte, k uint) (ret [][sha512.Size256]byte) {
+func seedHashes(hf func() hash.Hash, seedValue []byte, k uint) (ret [][]byte) {
 	for i := 0; i < int(k); i++ {
-		ret = append(ret, iHash(seedValue, i))
+		ret = append(ret, iHash(hf, seedValue, i))
 	}
 	return
 }
 
+// seedHashes returns the k seed hashes of seedValue for DBF, mixing in its domain if it has one
+func (dbf *DistBF) seedHashes(seedValue []byte, k uint) [][]byte {
+	if len(dbf.domain) == 0 {
+		return seedHashes(dbf.hashFunc(), seedValue, k)
+	}
+	// the length prefix keeps domain and seed boundaries unambiguous
+	data := make([]byte, 4, 4+len(dbf.domain)+len(seedValue))
+	binary.BigEndian.PutUint32(data, uint32(len(dbf.domain)))
+	data = append(append(data, dbf.domain...), seedValue...)
+	return seedHashes(dbf.hashFunc(), data, k)
+}
+
 // addElementHash xor the result of function hashOfXOR with the hash of element (component wise)❤
-func addElementHash(element []byte, hashes [][sha512.Size256]byte) [][sha512.Size256]byte {
-	ret := make([][sha512.Size256]byte, len(hashes))
-	h := hashElement(element)
+func addElementHash(hf func() hash.Hash, element []byte, hashes [][]byte) [][]byte {
+	return addDigest(hashElement(hf, element), hashes)
+}
+
+// addDigest xor the hash of an element with each of hashes
+func addDigest(digest []byte, hashes [][]byte) [][]byte {
+	ret := make([][]byte, len(hashes))
 	for i := 0; i < len(hashes); i++ {
-		ret[i] = xorHash(hashes[i], h)
+		ret[i] = xorHash(hashes[i], digest)
 	}
 	return ret
 }
 
 // hashesModule find the location where to set bits in Bloom Filter
-func hashesModulo(m uint, hashes [][sha512.Size256]byte) (ret []uint) {
+func hashesModulo(m uint, hashes [][]byte) (ret []uint) {
 	for _, hash := range hashes {
 		ret = append(ret, byteModuloM(m, hash))
 	}
 	return
 }
 
-// Add element to DBF
+// appendDigestIndices appends the dbf indices of the element with the given hash under hashes to dst like
+// digestIndices, using scratch for the xor with the seed hashes instead of allocating them.
+// Only the first 8 bytes of each xor, those byteModuloM reads, are computed and reduced modulo m.
+func (dbf *DistBF) appendDigestIndices(dst []uint, hashes [][]byte, digest []byte, scratch *[8]byte) []uint {
+	xor := scratch[:]
+	if len(digest) < len(xor) {
+		xor = xor[:len(digest)]
+	}
+	p := dbf.m
+	if dbf.partitioned {
+		p = dbf.m / dbf.k
+	}
+	for j, h := range hashes {
+		for i := range xor {
+			xor[i] = h[i] ^ digest[i]
+		}
+		var location uint
+		if dbf.littleEndian {
+			location = byteModuloMLittleEndian(p, xor)
+		} else {
+			location = byteModuloM(p, xor)
+		}
+		if dbf.partitioned {
+			location += uint(j) * p
+		}
+		dst = append(dst, location)
+	}
+	return dst
+}
+
+// Add element to DBF, element is only hashed and can be reused once Add returns
 func (dbf *DistBF) Add(element []byte) {
-	tmp := addElementHash(element, dbf.h)
-	locations := hashesModulo(dbf.m, tmp)
+	dbf.mustBeMutable()
+	dbf.countAdds(1)
+	digest := hashElement(dbf.hashFunc(), element)
+	dbf.addSummary(digest)
+	dbf.auditAdd(digest)
+	dbf.setLocations(dbf.digestIndices(digest))
+}
+
+// AddChecked adds element like Add, unless the fill ratio of DBF already reached the limit set by
+// WithMaxFillRatio, then it returns ErrFilterFull and leaves DBF unchanged
+func (dbf *DistBF) AddChecked(element []byte) error {
+	if dbf.frozen {
+		return ErrFrozen
+	}
+	if dbf.maxFill > 0 {
+		if !dbf.setBitsKnown {
+			dbf.setBits = dbf.Count()
+			dbf.setBitsKnown = true
+		}
+		if float64(dbf.setBits)/float64(dbf.m) >= dbf.maxFill {
+			return ErrFilterFull
+		}
+	}
+	dbf.Add(element)
+	return nil
+}
+
+// setLocations sets the bits at locations, counting the newly set ones while the set bits are known
+func (dbf *DistBF) setLocations(locations []uint) {
+	if !dbf.setBitsKnown {
+		for _, location := range locations {
+			dbf.b.Set(location)
+		}
+		return
+	}
 	for _, location := range locations {
-		dbf.b.Set(location)
+		if !dbf.b.Test(location) {
+			dbf.b.Set(location)
+			dbf.setBits++
+		}
+	}
+}
+
+// forgetSetBits makes the next AddChecked count the set bits again, for when they changed other than
+// through setLocations
+func (dbf *DistBF) forgetSetBits() {
+	dbf.setBitsKnown = false
+}
+
+// AddString adds s like Add([]byte(s)) without converting it to a byte slice, s is hashed in fixed size chunks
+func (dbf *DistBF) AddString(s string) {
+	dbf.mustBeMutable()
+	dbf.countAdds(1)
+	digest := dbf.stringDigest(s)
+	dbf.addSummary(digest)
+	dbf.auditAdd(digest)
+	dbf.setLocations(dbf.digestIndices(digest))
+}
+
+// AddUint64 adds v as the element of its 8 byte big endian encoding, so peers encoding IDs this way agree
+func (dbf *DistBF) AddUint64(v uint64) {
+	dbf.Add(uint64Element(v))
+}
+
+// ContainsUint64 returns Contains of the 8 byte big endian encoding of v, like AddUint64
+func (dbf *DistBF) ContainsUint64(v uint64) bool {
+	return dbf.Contains(uint64Element(v))
+}
+
+// KeyEncoder is a structured key that encodes itself to the bytes added as its element. Peers must encode
+// equal keys to the same bytes and different keys to different bytes, for example with fixed width or length
+// prefixed fields, or their DBFs disagree.
+type KeyEncoder interface {
+	EncodeKey() []byte
+}
+
+// AddKey adds the encoding of key like Add(key.EncodeKey())
+func (dbf *DistBF) AddKey(key KeyEncoder) {
+	dbf.Add(key.EncodeKey())
+}
+
+// ContainsKey returns Contains(key.EncodeKey())
+func (dbf *DistBF) ContainsKey(key KeyEncoder) bool {
+	return dbf.Contains(key.EncodeKey())
+}
+
+func uint64Element(v uint64) []byte {
+	var element [8]byte
+	binary.BigEndian.PutUint64(element[:], v)
+	return element[:]
+}
+
+// stringDigest hashes s like hashElement([]byte(s)) without copying s whole. Hashes that do not implement
+// io.StringWriter get s in chunks through a buffer of one SHA-512 block, which escapes through the hash
+// interface anyway, so it is allocated once and then holds the digest instead of Sum allocating another.
+func (dbf *DistBF) stringDigest(s string) []byte {
+	h := dbf.hashFunc()()
+	if sw, ok := h.(io.StringWriter); ok {
+		sw.WriteString(s)
+		return h.Sum(nil)
+	}
+	buf := make([]byte, sha512.BlockSize)
+	for len(s) > 0 {
+		n := copy(buf, s)
+		h.Write(buf[:n])
+		s = s[n:]
+	}
+	return h.Sum(buf[:0])
+}
+
+// PreviewAdd returns the indices Add would set for element and how many bits it would flip, without changing DBF
+func (dbf *DistBF) PreviewAdd(element []byte) (indices []uint, newBits uint) {
+	indices = dbf.GetElementIndices(element)
+	for i, location := range indices {
+		if dbf.b.Test(location) || containsIndex(indices[:i], location) {
+			continue
+		}
+		newBits++
+	}
+	return
+}
+
+func containsIndex(indices []uint, index uint) bool {
+	for _, i := range indices {
+		if i == index {
+			return true
+		}
+	}
+	return false
+}
+
+// AddBatch adds every element to DBF like Add, reusing one hash and the temporary buffers for all of them
+func (dbf *DistBF) AddBatch(elements [][]byte) {
+	dbf.mustBeMutable()
+	dbf.countAdds(len(elements))
+	dbf.batchIndices(elements, func(_ int, digest []byte, locations []uint) {
+		dbf.addSummary(digest)
+		dbf.auditAdd(digest)
+		dbf.setLocations(locations)
+	})
+}
+
+// batchIndices calls fn with the position, the hash and the indices of every element, reusing one hash and
+// the temporary buffers, so digest and locations are only valid until fn returns
+func (dbf *DistBF) batchIndices(elements [][]byte, fn func(i int, digest []byte, locations []uint)) {
+	h := dbf.hashFunc()()
+	digest := make([]byte, 0, h.Size())
+	scratch := new([8]byte)
+	locations := make([]uint, 0, dbf.k)
+	for i, elem := range elements {
+		h.Reset()
+		h.Write(elem)
+		digest = h.Sum(digest[:0])
+		locations = dbf.appendDigestIndices(locations[:0], dbf.hashes(), digest, scratch)
+		fn(i, digest, locations)
+	}
+}
+
+// AddReader adds the content of r as one element, streaming it through the hash instead of buffering it
+func (dbf *DistBF) AddReader(r io.Reader) error {
+	if dbf.frozen {
+		return ErrFrozen
+	}
+	h := dbf.hashFunc()()
+	if _, err := io.Copy(h, r); err != nil {
+		return err
+	}
+	dbf.countAdds(1)
+	digest := h.Sum(nil)
+	dbf.addSummary(digest)
+	dbf.auditAdd(digest)
+	dbf.setLocations(dbf.digestIndices(digest))
+	return nil
+}
+
+// Clone returns an independent copy of DBF, with its own bit array, seed hashes and stats counters, that is not frozen
+func (dbf *DistBF) Clone() *DistBF {
+	h := dbf.hashes()
+	c := *dbf
+	c.b = dbf.b.Clone()
+	if dbf.summary != nil {
+		c.summary = dbf.summary.Clone()
+	}
+	c.s = append([]byte(nil), dbf.s...)
+	c.frozen = false
+	// GrowBy, FoldTo and Difference change the bits of the clone
+	c.forgetSetBits()
+	if dbf.cache != nil {
+		c.cache = dbf.cache.empty()
+	}
+	if dbf.stats != nil {
+		c.stats = new(statsCounters)
+	}
+	if dbf.audit != nil {
+		c.audit = dbf.audit.clone()
+	}
+	c.h = make([][]byte, len(h))
+	for i, h := range h {
+		c.h[i] = append([]byte(nil), h...)
+	}
+	return &c
+}
+
+// RebuildWithSeed returns a new DBF with the m, k and options of DBF under newSeed holding elements.
+// A DBF cannot enumerate its elements, so rotating the seed requires the caller to keep the original elements.
+func (dbf *DistBF) RebuildWithSeed(newSeed []byte, elements [][]byte) *DistBF {
+	rebuilt := dbf.Clone()
+	rebuilt.b.ClearAll()
+	rebuilt.resetSummary()
+	rebuilt.resetAudit()
+	rebuilt.s = append([]byte(nil), newSeed...)
+	rebuilt.resetSeedHashes()
+	rebuilt.AddBatch(elements)
+	return rebuilt
+}
+
+// Clear unsets every bit of DBF, keeping m, k and the seed hashes so it can be reused
+func (dbf *DistBF) Clear() {
+	dbf.mustBeMutable()
+	dbf.b.ClearAll()
+	dbf.forgetSetBits()
+	dbf.resetSummary()
+	dbf.resetAudit()
+}
+
+// Resize empties DBF and sizes it for n elements at the false positive rate fpr, keeping the seed and options.
+// DBFs resized with the same n and fpr can be merged again.
+func (dbf *DistBF) Resize(n uint, fpr float64) {
+	dbf.mustBeMutable()
+	dbf.m, dbf.k = EstimateParameters(n, fpr)
+	dbf.clampPartitions()
+	dbf.n = n
+	dbf.fpr = fpr
+	dbf.resetSeedHashes()
+	dbf.b = bitset.New(dbf.m)
+	dbf.forgetSetBits()
+	dbf.resetSummary()
+	dbf.resetAudit()
+}
+
+// GrowBy returns a DBF with factor times the bits of DBF that still contains its elements, without needing
+// them again. An index is the element hash modulo m, so modulo factor*m it is the old index plus a multiple of
+// m, and the bit pattern of DBF is repeated factor times. The fill ratio, and so the false positive rate, stays
+// that of DBF: growing does not undo saturation, it only makes further elements raise the rate more slowly.
+// Partitioned DBFs cannot grow, since their indices do not reduce that way.
+func (dbf *DistBF) GrowBy(factor uint) (*DistBF, error) {
+	if factor == 0 {
+		return nil, errors.New("DBF: growth factor must be greater than 0")
 	}
+	if dbf.partitioned {
+		return nil, errors.New("DBF: partitioned filters cannot grow")
+	}
+	m := dbf.m * factor
+	if m/factor != dbf.m {
+		return nil, fmt.Errorf("DBF: m=%d times %d overflows uint", dbf.m, factor)
+	}
+	grown := dbf.Clone()
+	grown.m = m
+	grown.n = dbf.n * factor
+	grown.b = bitset.New(m)
+	dbf.ForEachSetBit(func(index uint) bool {
+		for j := uint(0); j < factor; j++ {
+			grown.b.Set(index + j*dbf.m)
+		}
+		return true
+	})
+	return grown, nil
+}
+
+// FoldTo returns a DBF with m bits, a divisor of the m of DBF, where bit i is the OR of every bit of DBF at an
+// index congruent to i modulo m. Since an index modulo a divisor of the old m is the old index reduced further,
+// every element of DBF is still contained, so differently sized peers can fold to a common m and merge.
+// The folded bits are denser: with a fill ratio f and r = old m / m, the fill ratio grows to about 1-(1-f)^r
+// and the false positive rate to its k-th power. Partitioned DBFs cannot fold.
+func (dbf *DistBF) FoldTo(m uint) (*DistBF, error) {
+	if m == 0 || dbf.m%m != 0 {
+		return nil, fmt.Errorf("DBF: m=%d is not a divisor of m=%d", m, dbf.m)
+	}
+	if dbf.partitioned {
+		return nil, errors.New("DBF: partitioned filters cannot fold")
+	}
+	folded := dbf.Clone()
+	folded.m = m
+	folded.n = dbf.n / (dbf.m / m)
+	folded.b = bitset.New(m)
+	dbf.ForEachSetBit(func(index uint) bool {
+		folded.b.Set(index % m)
+		return true
+	})
+	return folded, nil
+}
+
+// resetSeedHashes recomputes the seed hashes for the seed and k of DBF, or defers it to their next use
+// if they are lazy, and empties the index cache
+func (dbf *DistBF) resetSeedHashes() {
+	if dbf.cache != nil {
+		dbf.cache = dbf.cache.empty()
+	}
+	if dbf.lazy != nil {
+		dbf.h = nil
+		dbf.lazy = new(sync.Once)
+		return
+	}
+	dbf.h = dbf.seedHashes(dbf.s, dbf.k)
+}
+
+// hashes returns the seed hashes of DBF, computing them first if they are lazy
+func (dbf *DistBF) hashes() [][]byte {
+	if dbf.lazy != nil {
+		dbf.lazy.Do(func() {
+			dbf.h = dbf.seedHashes(dbf.s, dbf.k)
+		})
+	}
+	return dbf.h
+}
+
+// Freeze makes DBF read only, so a published DBF cannot be changed by accident. Afterwards the methods that
+// modify it return ErrFrozen, or panic with it if they return no error, while queries keep working.
+// Clone returns a copy that can be modified again.
+func (dbf *DistBF) Freeze() {
+	dbf.frozen = true
+}
+
+// Frozen returns true if Freeze was called on DBF
+func (dbf *DistBF) Frozen() bool {
+	return dbf.frozen
+}
+
+// mustBeMutable panics with ErrFrozen if DBF is frozen
+func (dbf *DistBF) mustBeMutable() {
+	if dbf.frozen {
+		panic(ErrFrozen)
+	}
+}
+
+// Validate returns an error describing the first broken invariant of DBF, for DBFs decoded or built by hand:
+// m and k must be greater than 0, there must be k seed hashes of the digest size of the hash function and
+// the bit array must have m bits with none set beyond m
+func (dbf *DistBF) Validate() error {
+	if dbf.m == 0 || dbf.k == 0 {
+		return fmt.Errorf("DBF: m=%d and k=%d must be greater than 0", dbf.m, dbf.k)
+	}
+	if dbf.partitioned && dbf.m < dbf.k {
+		return fmt.Errorf("DBF: partitioned filter has m=%d below k=%d", dbf.m, dbf.k)
+	}
+	h := dbf.hashes()
+	if uint(len(h)) != dbf.k {
+		return fmt.Errorf("DBF: %d seed hashes for k=%d", len(h), dbf.k)
+	}
+	size := dbf.hashFunc()().Size()
+	for i, seedHash := range h {
+		if len(seedHash) != size {
+			return fmt.Errorf("DBF: seed hash %d has %d bytes, want %d", i, len(seedHash), size)
+		}
+	}
+	if dbf.b == nil {
+		return errors.New("DBF: missing bit array")
+	}
+	if dbf.b.Len() != dbf.m {
+		return fmt.Errorf("DBF: bit array has %d bits, want m=%d", dbf.b.Len(), dbf.m)
+	}
+	if words := dbf.b.Bytes(); uint(len(words)) != (dbf.m+63)/64 {
+		return fmt.Errorf("DBF: bit array has %d words, want %d for m=%d", len(words), (dbf.m+63)/64, dbf.m)
+	} else if dbf.m%64 != 0 && words[len(words)-1]>>(dbf.m%64) != 0 {
+		return fmt.Errorf("DBF: bits set beyond m=%d", dbf.m)
+	}
+	return nil
 }
 
 // compare takes two bitset arrays and returns whether they are comparable (coordinate wise)
@@ -102,8 +642,8 @@ func (dbf *DistBF) syncBloomFilter(nonce []byte, otherBF *bitset.BitSet, element
 
 // VerifyElement returns true if element is in DBF, false otherwise
 func (dbf *DistBF) VerifyElement(elem []byte) bool {
-	tmp := addElementHash(elem, dbf.h)
-	locations := hashesModulo(dbf.m, tmp)
+	dbf.countQueries(1)
+	locations := dbf.GetElementIndices(elem)
 	for i := uint(0); i < dbf.k; i++ {
 		if !dbf.b.Test(locations[i]) {
 			return false
@@ -112,10 +652,131 @@ func (dbf *DistBF) VerifyElement(elem []byte) bool {
 	return true
 }
 
+// Contains returns true if element is probably in DBF, false if it is definitely not
+func (dbf *DistBF) Contains(element []byte) bool {
+	dbf.countQueries(1)
+	if dbf.m == 0 {
+		return false
+	}
+	digest := hashElement(dbf.hashFunc(), element)
+	if dbf.summaryExcludes(digest) {
+		return false
+	}
+	return dbf.testAll(dbf.digestIndices(digest))
+}
+
+// ContainsConstantTime returns Contains(element), but reads all k bits and combines them without branching on
+// their values, so the time taken does not reveal how many of them are set. It skips the summary and the
+// index cache, whose hits would show in the timing too, and is slower than Contains for absent elements.
+// The words read still depend on the element, so it does not hide cache effects of the memory accesses.
+func (dbf *DistBF) ContainsConstantTime(element []byte) bool {
+	dbf.countQueries(1)
+	if dbf.m == 0 {
+		return false
+	}
+	words := dbf.b.Bytes()
+	if n := (dbf.m + 63) / 64; uint(len(words)) < n {
+		// a bit array shorter than m, as SetBitSet allows, reads as unset beyond its end like for Contains
+		words = append(make([]uint64, 0, n), words...)[:n]
+	}
+	all := uint64(1)
+	for _, location := range dbf.hashesIndices(dbf.hashes(), hashElement(dbf.hashFunc(), element)) {
+		all &= words[location/64] >> (location % 64)
+	}
+	return all&1 == 1
+}
+
+// ContainsDebug returns Contains(element) and the indices of element that are not set in the dbf, in the order
+// of GetElementIndices, each reported once. missing is empty when present is true.
+func (dbf *DistBF) ContainsDebug(element []byte) (present bool, missing []uint) {
+	dbf.countQueries(1)
+	if dbf.m == 0 {
+		return false, nil
+	}
+	for _, index := range dbf.GetElementIndices(element) {
+		if !dbf.b.Test(index) && !containsIndex(missing, index) {
+			missing = append(missing, index)
+		}
+	}
+	return len(missing) == 0, missing
+}
+
+// Membership returns the fraction of the k indices of element that are set, 1 if DBF probably contains it.
+// It is a heuristic score for near membership, not the probability that element was added.
+func (dbf *DistBF) Membership(element []byte) float64 {
+	dbf.countQueries(1)
+	if dbf.m == 0 {
+		return 0
+	}
+	indices := dbf.GetElementIndices(element)
+	set := 0
+	for _, index := range indices {
+		if dbf.b.Test(index) {
+			set++
+		}
+	}
+	return float64(set) / float64(len(indices))
+}
+
+// ContainsString returns Contains([]byte(s)) without converting s to a byte slice, like AddString
+func (dbf *DistBF) ContainsString(s string) bool {
+	dbf.countQueries(1)
+	if dbf.m == 0 {
+		return false
+	}
+	digest := dbf.stringDigest(s)
+	if dbf.summaryExcludes(digest) {
+		return false
+	}
+	return dbf.testAll(dbf.digestIndices(digest))
+}
+
+// testAll returns true if every location is set
+func (dbf *DistBF) testAll(locations []uint) bool {
+	for _, location := range locations {
+		if !dbf.b.Test(location) {
+			return false
+		}
+	}
+	return true
+}
+
+// ContainsBatch returns Contains of every element in order, reusing one hash and the temporary buffers
+func (dbf *DistBF) ContainsBatch(elements [][]byte) []bool {
+	dbf.countQueries(len(elements))
+	results := make([]bool, len(elements))
+	if dbf.m == 0 {
+		return results
+	}
+	dbf.batchIndices(elements, func(i int, _ []byte, locations []uint) {
+		results[i] = dbf.testAll(locations)
+	})
+	return results
+}
+
+// ContainsAll returns true if every element is probably in DBF, it is true for an empty slice
+func (dbf *DistBF) ContainsAll(elements [][]byte) bool {
+	for _, elem := range elements {
+		if !dbf.Contains(elem) {
+			return false
+		}
+	}
+	return true
+}
+
+// ContainsAny returns true if at least one element is probably in DBF
+func (dbf *DistBF) ContainsAny(elements [][]byte) bool {
+	for _, elem := range elements {
+		if dbf.Contains(elem) {
+			return true
+		}
+	}
+	return false
+}
+
 // VerifyBitArray returns true if element is in the other DBF, false otherwise
 func VerifyBitArray(dbf *DistBF, elem []byte, b *bitset.BitSet) bool {
-	tmp := addElementHash(elem, dbf.h)
-	locations := hashesModulo(dbf.m, tmp)
+	locations := dbf.GetElementIndices(elem)
 	for i := uint(0); i < dbf.k; i++ {
 		if !b.Test(locations[i]) {
 			return false
@@ -124,48 +785,149 @@ func VerifyBitArray(dbf *DistBF, elem []byte, b *bitset.BitSet) bool {
 	return true
 }
 
+// BitArray returns the bit array of DBF itself, since it may be modified through it the summary is dropped
 func (dbf *DistBF) BitArray() *bitset.BitSet {
+	dbf.dropSummary()
 	return dbf.b
 }
 
+// Words returns the backing words of the bit array without copying, callers must not modify them.
+// Bit i of the DBF is bit i%64 of word i/64, counting from the least significant bit, and the bits of the
+// last word beyond m are 0. The words are plain uint64 values, byte order only matters once they are
+// serialized, as MarshalBinary does big endian.
+func (dbf *DistBF) Words() []uint64 {
+	return dbf.b.Bytes()
+}
+
+// BitArrayBytes returns a copy of the bits packed into ceil(m/8) bytes, bit i of the DBF is bit i%8 of byte
+// i/8 counting from the least significant bit, and the bits of the last byte beyond m are 0. It is the bit
+// payload of the dense MarshalBinary encoding.
+func (dbf *DistBF) BitArrayBytes() []byte {
+	return bitSetToBytes(dbf.b, dbf.m)
+}
+
+// ExportBitIndices returns the indices of every set bit in ascending order, each below m, for moving the bits
+// to another bloom filter implementation such as a willf/bloom filter with the same m, by setting the same
+// positions in its bit set. It matches GetBitIndices. Only the bits move: the other implementation computes
+// indices with its own hashes, so elements must still be queried through a DBF with the same seed.
+func (dbf *DistBF) ExportBitIndices() []uint {
+	return dbf.GetBitIndices()
+}
+
 func (dbf *DistBF) NumOfHashes() uint {
 	return dbf.k
 }
 
+// String returns a short summary of DBF with the first bytes of its seed fingerprint, not its bits
+func (dbf *DistBF) String() string {
+	fp := dbf.SeedFingerprint()
+	count := dbf.Count()
+	return fmt.Sprintf("DistBF{m=%d k=%d set=%d fill=%.1f%% seed=%x}",
+		dbf.m, dbf.k, count, 100*float64(count)/float64(dbf.m), fp[:3])
+}
+
 func NewDBFBitSet(b *bitset.BitSet) *DistBF {
 	return nil
 }
 
-// GetBitIndices returns the indices of every 1 in the dbf
+// GetBitIndices returns the indices of every 1 in the dbf in ascending order
 func (dbf *DistBF) GetBitIndices() (indices []uint) {
-	for i := uint(0); i < dbf.m; i++ {
-		if dbf.b.Test(i) {
-			indices = append(indices, i)
+	return dbf.AppendBitIndices(nil)
+}
+
+// AppendBitIndices appends the indices of every 1 in the dbf to dst in ascending order, reusing its capacity
+func (dbf *DistBF) AppendBitIndices(dst []uint) []uint {
+	for i, ok := dbf.b.NextSet(0); ok && i < dbf.m; i, ok = dbf.b.NextSet(i + 1) {
+		dst = append(dst, i)
+	}
+	return dst
+}
+
+// ForEachSetBit calls fn with the index of every 1 in the dbf in ascending order, until fn returns false
+func (dbf *DistBF) ForEachSetBit(fn func(index uint) bool) {
+	for i, ok := dbf.b.NextSet(0); ok && i < dbf.m; i, ok = dbf.b.NextSet(i + 1) {
+		if !fn(i) {
+			return
 		}
 	}
-	return
+}
+
+// Count returns the number of set bits in the dbf using a popcount over the bit array words
+func (dbf *DistBF) Count() uint {
+	return dbf.b.Count()
 }
 
 // GetElementIndices returns the dbf indices an element would have if mapped to the dbf
 func (dbf *DistBF) GetElementIndices(elem []byte) (indices []uint) {
-	tmp := addElementHash(elem, dbf.h)
-	indices = hashesModulo(dbf.m, tmp)
-	return
+	indices = dbf.elementIndices(elem)
+	if dbf.cache != nil {
+		indices = append([]uint(nil), indices...)
+	}
+	return indices
+}
+
+// ElementFingerprint returns the SHA-512/256 of the k hashes of element derived from the seed hashes, a key
+// for routing element to one of several DBFs that peers sharing the seed and options agree on. An XOR fold of
+// the derived hashes would cancel the element hash for even k, so they are hashed instead.
+func (dbf *DistBF) ElementFingerprint(element []byte) [sha512.Size256]byte {
+	return dbf.digestFingerprint(hashElement(dbf.hashFunc(), element))
+}
+
+// digestFingerprint returns the ElementFingerprint of the element with the given hash
+func (dbf *DistBF) digestFingerprint(digest []byte) [sha512.Size256]byte {
+	h := sha512.New512_256()
+	for _, derived := range addDigest(digest, dbf.hashes()) {
+		h.Write(derived)
+	}
+	var fp [sha512.Size256]byte
+	h.Sum(fp[:0])
+	return fp
+}
+
+// elementIndices returns the indices of elem like GetElementIndices, they may be shared with the index
+// cache and must not be modified
+func (dbf *DistBF) elementIndices(elem []byte) []uint {
+	return dbf.digestIndices(hashElement(dbf.hashFunc(), elem))
+}
+
+// ElementIndices returns the indices of element in a DBF with m bits, k hashes and seed s without creating it.
+// It matches GetElementIndices of NewDbf and NewDbfWithParams, which use no options.
+func ElementIndices(element []byte, m, k uint, s []byte) []uint {
+	return hashesModulo(m, addElementHash(sha512.New512_256, element, seedHashes(sha512.New512_256, s, k)))
+}
+
+// digestIndices returns the dbf indices of the element with the given hash, through the index cache if
+// there is one, so they must not be modified
+func (dbf *DistBF) digestIndices(digest []byte) []uint {
+	if dbf.cache == nil {
+		return dbf.hashesIndices(dbf.hashes(), digest)
+	}
+	if indices, ok := dbf.cache.get(digest); ok {
+		return indices
+	}
+	indices := dbf.hashesIndices(dbf.hashes(), digest)
+	dbf.cache.add(digest, indices)
+	return indices
+}
+
+// hashesIndices returns the dbf indices of the element with the given hash under hashes
+func (dbf *DistBF) hashesIndices(hashes [][]byte, digest []byte) []uint {
+	var scratch [8]byte
+	return dbf.appendDigestIndices(make([]uint, 0, len(hashes)), hashes, digest, &scratch)
 }
 
 // MapElementToBF returns the indices an element would have if mapped to a dbf, but with a different seedValue
 func (dbf *DistBF) MapElementToBF(elem, seedValue []byte) (indices []uint) {
-	h := seedHashes(seedValue, dbf.k)
-	tmp := addElementHash(elem, h)
-	indices = hashesModulo(dbf.m, tmp)
+	h := dbf.seedHashes(seedValue, dbf.k)
+	indices = dbf.hashesIndices(h, hashElement(dbf.hashFunc(), elem))
 	return
 }
 
 // Proof returns true if element is in DBF, false otherwise
 func (dbf *DistBF) Proof(elem []byte) ([]uint64, bool) {
+	dbf.countQueries(1)
 	var ret []uint64
-	tmp := addElementHash(elem, dbf.h)
-	locations := hashesModulo(dbf.m, tmp)
+	locations := dbf.GetElementIndices(elem)
 	for i := uint(0); i < dbf.k; i++ {
 		if !dbf.b.Test(locations[i]) {
 			return []uint64{uint64(locations[i])}, false
@@ -176,20 +938,21 @@ func (dbf *DistBF) Proof(elem []byte) ([]uint64, bool) {
 	return ret, true
 }
 
-
 // helper struct to encode DBF to byte
 type DEncode struct {
 	B []byte
 	M uint
 	K uint
-	H [][sha512.Size256]byte
+	H [][]byte
+	S []byte
 }
 
 func (dbf *DistBF) Bytes() ([]byte, error) {
 	var dE DEncode
 	dE.M = dbf.m
-	dE.H = dbf.h
+	dE.H = dbf.hashes()
 	dE.K = dbf.k
+	dE.S = dbf.s
 	b, err := dbf.b.MarshalBinary()
 	if err != nil {
 		return nil, err
@@ -217,6 +980,7 @@ func UnmarshalBinary(b []byte) (*DistBF, error) {
 	d.m = dE.M
 	d.h = dE.H
 	d.k = dE.K
+	d.s = dE.S
 
 	bloom := bitset.New(0)
 	err := bloom.UnmarshalBinary(dE.B)
@@ -227,13 +991,18 @@ func UnmarshalBinary(b []byte) (*DistBF, error) {
 
 	return &d, nil
 }
+
 // SetIndices increments bit array values without inserting an element.
 func (dbf *DistBF) SetIndices(indices []int) {
+	dbf.mustBeMutable()
+	dbf.dropSummary()
 	for _, elm := range indices {
 		dbf.b.Set(uint(elm))
 	}
 }
 
 func (dbf *DistBF) SetBitSet(b *bitset.BitSet) {
+	dbf.mustBeMutable()
+	dbf.dropSummary()
 	dbf.b = b
 }
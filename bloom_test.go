@@ -1,12 +1,21 @@
 package DBF
 
 import (
+	"bytes"
+	"crypto/sha256"
 	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/fnv"
+	"math"
 	"math/rand"
+	"strings"
 	"testing"
-	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/willf/bitset"
 	"github.com/willf/bloom"
 )
 
@@ -45,10 +54,16 @@ func TestXorHash(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got := xorHash(tt.args.a, tt.args.b)
-			assert.Equalf(t, got, tt.want, "xor() = %v, want %v", got, tt.want)
+			got := xorHash(tt.args.a[:], tt.args.b[:])
+			assert.Equalf(t, got, tt.want[:], "xor() = %v, want %v", got, tt.want)
 		})
 	}
+	t.Run("different lengths", func(t *testing.T) {
+		assert.Panics(t, func() { xorHash(ca[:], cb[:16]) })
+	})
+	t.Run("other width", func(t *testing.T) {
+		assert.Equal(t, []byte{3, 0, 1}, xorHash([]byte{1, 2, 3}, []byte{2, 2, 2}))
+	})
 }
 
 // tests are done under assumption that fpr=0.1
@@ -96,19 +111,19 @@ func TestSeedHashes(t *testing.T) {
 	d.k = uint(10)
 	d.m = 100
 	seed := []byte("2")
-	hashes := seedHashes(seed, d.k)
+	hashes := seedHashes(sha512.New512_256, seed, d.k)
 	// there should be k hashes
 	if len(hashes) != k {
 		t.Fatal("there are not k hashes")
 	}
 	// check for uniqueness
-	hashesUniqueness := make(map[[sha512.Size256]byte]bool)
+	hashesUniqueness := make(map[string]bool)
 	for i := 0; i < k; i++ {
 		hash := hashes[i]
-		if ok := hashesUniqueness[hash]; ok {
+		if ok := hashesUniqueness[string(hash)]; ok {
 			t.Fatal("hash previously existed")
 		} else {
-			hashesUniqueness[hash] = true
+			hashesUniqueness[string(hash)] = true
 		}
 	}
 }
@@ -120,37 +135,37 @@ func TestAddElementHash(t *testing.T) {
 	d.k = uint(10)
 	d.m = 100
 	seed := []byte("3")
-	hashes := seedHashes(seed, d.k)
+	hashes := seedHashes(sha512.New512_256, seed, d.k)
 	// there should be k hashes
 	if len(hashes) != k {
 		t.Fatal("there are not k hashes")
 	}
 	// check for uniqueness
-	hashesUniqueness := make(map[[sha512.Size256]byte]bool)
+	hashesUniqueness := make(map[string]bool)
 	for i := 0; i < k; i++ {
 		hash := hashes[i]
-		if ok := hashesUniqueness[hash]; ok {
+		if ok := hashesUniqueness[string(hash)]; ok {
 			t.Fatal("hash previously existed")
 		} else {
-			hashesUniqueness[hash] = true
+			hashesUniqueness[string(hash)] = true
 		}
 	}
 	// now we add hashes of element
 	element := []byte("message")
-	oldHashes := make([][sha512.Size256]byte, len(hashes))
+	oldHashes := make([][]byte, len(hashes))
 	copy(oldHashes, hashes)
-	hashes = addElementHash(element, hashes)
+	hashes = addElementHash(sha512.New512_256, element, hashes)
 	// check for uniqueness and if it changes
-	newHashes := make(map[[sha512.Size256]byte]bool)
+	newHashes := make(map[string]bool)
 	for i := 0; i < k; i++ {
 		hash := hashes[i]
-		if hashes[i] == oldHashes[i] {
+		if bytes.Equal(hashes[i], oldHashes[i]) {
 			t.Fatal("hash did not change")
 		}
-		if ok := newHashes[hash]; ok {
+		if ok := newHashes[string(hash)]; ok {
 			t.Fatal("hash previously existed")
 		} else {
-			newHashes[hash] = true
+			newHashes[string(hash)] = true
 		}
 	}
 }
@@ -167,7 +182,7 @@ func TestNew(t *testing.T) {
 func TestHashModulo(t *testing.T) {
 	dbf := NewDbf(11, 0.2, []byte("2"))
 	element := []byte("message")
-	tmp := addElementHash(element, dbf.h)
+	tmp := addElementHash(dbf.hashFunc(), element, dbf.h)
 	modulus := hashesModulo(dbf.m, tmp)
 	if len(modulus) != int(dbf.k) {
 		t.Fatal("there must be k bit strings")
@@ -195,7 +210,7 @@ func TestGetElementIndices(t *testing.T) {
 
 }
 
-func GetBitIndices(t *testing.T) {
+func TestGetBitIndices(t *testing.T) {
 	dbf := NewDbf(10, 0.5, []byte("seed"))
 	element := []byte("something")
 	element1 := []byte("something else")
@@ -223,9 +238,10 @@ func TestAdd(t *testing.T) {
 
 func BenchmarkAdd(b *testing.B) {
 	dbf := NewDbf(uint(b.N), 0.2, []byte("2"))
+	elements := RandomElements(b.N, 8, rand.New(rand.NewSource(1)))
+	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		elem := randStringBytes(8)
-		dbf.Add([]byte(elem))
+		dbf.Add(elements[i])
 	}
 }
 
@@ -234,7 +250,6 @@ const letterBytes = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
 func randStringBytes(n int) string {
 	b := make([]byte, n)
 	for i := range b {
-		rand.Seed(time.Now().UnixNano())
 		b[i] = letterBytes[rand.Intn(len(letterBytes))]
 	}
 	return string(b)
@@ -242,8 +257,956 @@ func randStringBytes(n int) string {
 
 func BenchmarkAddBloomFilter(b *testing.B) {
 	filter := bloom.New(uint(20*b.N), 4) // load of 20, 5 keys
+	elements := RandomElements(b.N, 8, rand.New(rand.NewSource(1)))
+	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		elem := randStringBytes(8)
-		filter.Add([]byte(elem))
+		filter.Add(elements[i])
+	}
+}
+
+func TestContains(t *testing.T) {
+	dbf := NewDbf(100, 0.1, []byte("seed"))
+	element := []byte("something")
+	if dbf.Contains(element) {
+		t.Fatal("empty dbf should not contain any element")
+	}
+	dbf.Add(element)
+	if !dbf.Contains(element) {
+		t.Fatal("added element should be contained in dbf")
+	}
+	if dbf.Contains([]byte("something else")) {
+		t.Fatal("element that was not added should not be contained in dbf")
+	}
+	if (&DistBF{}).Contains(element) {
+		t.Fatal("zero value dbf should not contain any element")
+	}
+}
+
+func TestAddDoesNotRetainElement(t *testing.T) {
+	buf := []byte("first second third")
+	words := [][]byte{buf[:5], buf[6:12], buf[13:]}
+	for _, dbf := range []*DistBF{
+		NewDbf(100, 0.01, []byte("seed")),
+		NewDbfWithOptions(100, 0.01, WithSeed([]byte("seed")), WithIndexCache(10)),
+	} {
+		for _, word := range words {
+			dbf.Add(word)
+		}
+		dbf.AddBatch(words)
+		before := dbf.Clone()
+		copy(buf, "xxxxxxxxxxxxxxxxxx")
+		if !dbf.Equals(before) {
+			t.Fatal("overwriting the added elements should not change the dbf")
+		}
+		for _, word := range []string{"first", "second", "third"} {
+			if !dbf.Contains([]byte(word)) {
+				t.Fatalf("%s should still be contained after its buffer was reused", word)
+			}
+		}
+		if dbf.Contains(buf[:5]) {
+			t.Fatal("the overwritten buffer should not be contained")
+		}
+		copy(buf, "first second third")
+	}
+}
+
+func TestAddUint64(t *testing.T) {
+	values := []uint64{0, 1, 255, 256, math.MaxUint32, math.MaxUint32 + 1, math.MaxUint64}
+	dbf := NewDbf(100, 0.01, []byte("seed"))
+	for _, v := range values {
+		dbf.AddUint64(v)
+	}
+	for _, v := range values {
+		if !dbf.ContainsUint64(v) {
+			t.Fatalf("added value %d should be contained", v)
+		}
+	}
+	if dbf.ContainsUint64(2) || dbf.ContainsUint64(math.MaxUint64-1) {
+		t.Fatal("values that were not added should not be contained")
+	}
+	// the element is the 8 byte big endian encoding
+	assert.True(t, dbf.Contains([]byte{0, 0, 0, 1, 0, 0, 0, 0}))
+	assert.False(t, dbf.Contains([]byte{1}))
+	other := NewDbf(100, 0.01, []byte("seed"))
+	other.AddUint64(256)
+	encoded := NewDbf(100, 0.01, []byte("seed"))
+	encoded.Add([]byte{0, 0, 0, 0, 0, 0, 1, 0})
+	if !other.Equals(encoded) {
+		t.Fatal("AddUint64 should add the big endian encoding")
+	}
+}
+
+// referenceIndices maps the full xor of the element hash with each seed hash to a DBF index, splitting m
+// into k partitions for partitioned DBFs
+func referenceIndices(dbf *DistBF, hashes [][]byte) (ret []uint) {
+	if !dbf.partitioned {
+		return hashesModulo(dbf.m, hashes)
+	}
+	p := dbf.m / uint(len(hashes))
+	for j, hash := range hashes {
+		ret = append(ret, uint(j)*p+byteModuloM(p, hash))
+	}
+	return
+}
+
+func TestGetElementIndicesMatchesFullXor(t *testing.T) {
+	filters := []*DistBF{
+		NewDbf(1000, 0.01, []byte("seed")),
+		NewDbfWithOptions(1000, 0.01, WithSeed([]byte("seed")), WithPartitioning()),
+		NewDbfWithHash(1000, 0.01, []byte("seed"), func() hash.Hash { return fnv.New32a() }),
+	}
+	for _, dbf := range filters {
+		for _, elem := range batchElements(100) {
+			full := referenceIndices(dbf, addElementHash(dbf.hashFunc(), elem, dbf.h))
+			assert.Equal(t, full, dbf.GetElementIndices(elem))
+		}
+	}
+}
+
+func TestContainsBatch(t *testing.T) {
+	dbf := NewDbf(100, 0.1, []byte("seed"))
+	elements := batchElements(200)
+	dbf.AddBatch(elements[:100])
+	results := dbf.ContainsBatch(elements)
+	assert.Len(t, results, len(elements))
+	for i, elem := range elements {
+		if results[i] != dbf.Contains(elem) {
+			t.Fatalf("ContainsBatch of element %d should match Contains", i)
+		}
+	}
+	assert.Empty(t, dbf.ContainsBatch(nil))
+}
+
+func TestContainsAllAny(t *testing.T) {
+	dbf := NewDbf(100, 0.1, []byte("seed"))
+	added := [][]byte{[]byte("a"), []byte("b"), []byte("c")}
+	missing := [][]byte{[]byte("x"), []byte("y")}
+	if dbf.ContainsAll(added) || dbf.ContainsAny(added) {
+		t.Fatal("empty dbf should not contain any element")
+	}
+	for _, elem := range added {
+		dbf.Add(elem)
+	}
+	if !dbf.ContainsAll(added) {
+		t.Fatal("all added elements should be contained in dbf")
+	}
+	if !dbf.ContainsAny(append(missing, added[0])) {
+		t.Fatal("one of the elements was added to dbf")
+	}
+	if dbf.ContainsAll(append(missing, added...)) {
+		t.Fatal("not all elements were added to dbf")
+	}
+	if dbf.ContainsAny(missing) {
+		t.Fatal("none of the elements were added to dbf")
+	}
+}
+
+func TestClear(t *testing.T) {
+	dbf := NewDbf(100, 0.1, []byte("seed"))
+	m, k, h := dbf.m, dbf.k, dbf.h
+	element := []byte("something")
+	dbf.Add(element)
+	dbf.Clear()
+	if len(dbf.GetBitIndices()) != 0 {
+		t.Fatal("cleared dbf should have no bits set")
+	}
+	if dbf.Contains(element) {
+		t.Fatal("cleared dbf should not contain previously added elements")
+	}
+	if dbf.m != m || dbf.k != k || !assert.Equal(t, h, dbf.h) {
+		t.Fatal("clear should keep the parameters of the dbf")
+	}
+	dbf.Add(element)
+	if !dbf.Contains(element) {
+		t.Fatal("cleared dbf should be reusable")
+	}
+}
+
+func TestGrowBy(t *testing.T) {
+	dbf := NewDbf(100, 0.01, []byte("seed"))
+	elements := batchElements(100)
+	dbf.AddBatch(elements)
+	grown, err := dbf.GrowBy(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 3*dbf.m, grown.m)
+	assert.Equal(t, dbf.k, grown.k)
+	for _, elem := range elements {
+		if !grown.Contains(elem) {
+			t.Fatal("grown dbf should contain every element of the original")
+		}
+	}
+	assert.InDelta(t, dbf.FillRatio(), grown.FillRatio(), 1e-12)
+	// further elements map like in a fresh DBF with the grown m
+	fresh := NewDbfWithParams(grown.m, grown.k, []byte("seed"))
+	assert.Equal(t, fresh.GetElementIndices([]byte("new")), grown.GetElementIndices([]byte("new")))
+	if _, err := dbf.GrowBy(0); err == nil {
+		t.Fatal("growing by 0 should fail")
+	}
+	partitioned := NewDbfWithOptions(100, 0.01, WithSeed([]byte("seed")), WithPartitioning())
+	if _, err := partitioned.GrowBy(2); err == nil {
+		t.Fatal("growing a partitioned dbf should fail")
+	}
+}
+
+func TestFoldTo(t *testing.T) {
+	dbf := NewDbfWithParams(12000, 5, []byte("seed"))
+	elements := batchElements(300)
+	dbf.AddBatch(elements)
+	folded, err := dbf.FoldTo(3000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, uint(3000), folded.m)
+	for _, elem := range elements {
+		if !folded.Contains(elem) {
+			t.Fatal("folded dbf should contain every element of the original")
+		}
+	}
+	if folded.FillRatio() <= dbf.FillRatio() {
+		t.Fatal("folding should raise the fill ratio")
+	}
+	// a folded dbf merges with a peer of the smaller m
+	peer := NewDbfWithParams(3000, 5, []byte("seed"))
+	peer.Add([]byte("peer"))
+	if err := folded.Union(peer); err != nil {
+		t.Fatal(err)
+	}
+	if !folded.Contains([]byte("peer")) || !folded.Contains(elements[0]) {
+		t.Fatal("merged dbf should contain the elements of both")
+	}
+	// folding back a grown dbf restores it
+	grown, err := peer.GrowBy(4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	back, err := grown.FoldTo(3000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !back.Equals(peer) {
+		t.Fatal("folding a grown dbf back should restore its bits")
+	}
+	for _, m := range []uint{0, 7000, 24000} {
+		if _, err := dbf.FoldTo(m); err == nil {
+			t.Fatalf("folding to m=%d should fail", m)
+		}
+	}
+}
+
+func TestFreeze(t *testing.T) {
+	dbf := NewDbf(100, 0.1, []byte("seed"))
+	dbf.Add([]byte("something"))
+	dbf.Freeze()
+	assert.True(t, dbf.Frozen())
+	before := dbf.Clone()
+	panics := map[string]func(){
+		"Add":              func() { dbf.Add([]byte("other")) },
+		"AddString":        func() { dbf.AddString("other") },
+		"AddBatch":         func() { dbf.AddBatch(batchElements(2)) },
+		"AddBatchParallel": func() { dbf.AddBatchParallel(batchElements(2), 2) },
+		"Clear":            func() { dbf.Clear() },
+		"Resize":           func() { dbf.Resize(1000, 0.1) },
+		"AtomicDistBF.Add": func() { NewAtomicDbf(dbf).Add([]byte("other")) },
+	}
+	for name, f := range panics {
+		assert.PanicsWithValue(t, ErrFrozen, f, name+" on a frozen dbf should panic")
+	}
+	other := NewDbf(100, 0.1, []byte("seed"))
+	data, err := other.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	errs := map[string]error{
+		"AddChecked":      dbf.AddChecked([]byte("other")),
+		"AddReader":       dbf.AddReader(strings.NewReader("other")),
+		"Union":           dbf.Union(other),
+		"Intersect":       dbf.Intersect(other),
+		"OrWords":         dbf.OrWords(other.Words()),
+		"UnmarshalBinary": dbf.UnmarshalBinary(data),
+	}
+	for name, err := range errs {
+		if err != ErrFrozen {
+			t.Fatalf("%s on a frozen dbf should fail with ErrFrozen, got %v", name, err)
+		}
+	}
+	if !dbf.Equals(before) || !dbf.Contains([]byte("something")) {
+		t.Fatal("a frozen dbf should not change and still answer queries")
+	}
+	clone := dbf.Clone()
+	assert.False(t, clone.Frozen())
+	clone.Add([]byte("other"))
+}
+
+func TestResize(t *testing.T) {
+	dbf := NewDbf(100, 0.1, []byte("seed"))
+	m := dbf.m
+	dbf.Add([]byte("old"))
+	dbf.Resize(10000, 0.01)
+	if dbf.m <= m {
+		t.Fatal("resizing to a larger n should grow m")
+	}
+	assert.Equal(t, NewDbf(10000, 0.01, []byte("seed")).h, dbf.h)
+	assert.Equal(t, uint(0), dbf.Count())
+	assert.Equal(t, dbf.OptimalK(), dbf.NumOfHashes())
+	peer := NewDbf(100, 0.1, []byte("seed"))
+	peer.Resize(10000, 0.01)
+	peer.Add([]byte("new"))
+	if err := dbf.Union(peer); err != nil {
+		t.Fatal(err)
+	}
+	if !dbf.Contains([]byte("new")) {
+		t.Fatal("merged dbf should contain the element of the peer")
+	}
+}
+
+func TestCount(t *testing.T) {
+	dbf := NewDbf(100, 0.1, []byte("seed"))
+	for i := 0; i < 200; i++ {
+		if i%20 == 0 && dbf.Count() != uint(len(dbf.GetBitIndices())) {
+			t.Fatal("count should equal the number of bit indices")
+		}
+		dbf.Add([]byte(randStringBytes(8)))
+	}
+}
+
+func TestNewDbfWithHash(t *testing.T) {
+	element := []byte("something")
+	for _, hf := range []func() hash.Hash{sha256.New, sha512.New, func() hash.Hash { return fnv.New32a() }} {
+		dbf := NewDbfWithHash(100, 0.1, []byte("seed"), hf)
+		for _, h := range dbf.h {
+			if len(h) != hf().Size() {
+				t.Fatal("seed hashes should have the digest size of the hash function")
+			}
+		}
+		dbf.Add(element)
+		if !dbf.Contains(element) {
+			t.Fatal("added element should be contained in dbf")
+		}
+	}
+	sha256Indices := NewDbfWithHash(100, 0.1, []byte("seed"), sha256.New).GetElementIndices(element)
+	defaultIndices := NewDbf(100, 0.1, []byte("seed")).GetElementIndices(element)
+	assert.NotEqual(t, defaultIndices, sha256Indices)
+}
+
+func TestNewDbfWithParams(t *testing.T) {
+	m, k := EstimateParameters(100, 0.1)
+	dbf := NewDbfWithParams(m, k, []byte("seed"))
+	if !dbf.Equals(NewDbf(100, 0.1, []byte("seed"))) {
+		t.Fatal("dbf with estimated parameters should equal NewDbf")
+	}
+	assert.Equal(t, seedHashes(sha512.New512_256, []byte("seed"), k), dbf.h)
+	assert.Panics(t, func() { NewDbfWithParams(0, k, []byte("seed")) })
+	assert.Panics(t, func() { NewDbfWithParams(m, 0, []byte("seed")) })
+}
+
+func TestBitArrayFootprint(t *testing.T) {
+	for _, m := range []uint{64, 1000, 1000000} {
+		dbf := NewDbfWithParams(m, 4, []byte("seed"))
+		for i := 0; i < 100; i++ {
+			dbf.Add([]byte(randStringBytes(8)))
+		}
+		if size := uint(len(dbf.b.Bytes()) * 8); size < m/8 || size > m/8+8 {
+			t.Fatalf("bit array of m=%d takes %d bytes, want about %d", m, size, m/8)
+		}
+	}
+}
+
+func TestClone(t *testing.T) {
+	dbf := NewDbf(100, 0.1, []byte("seed"))
+	element := []byte("something")
+	element1 := []byte("something else")
+	dbf.Add(element)
+	clone := dbf.Clone()
+	if !clone.Equals(dbf) {
+		t.Fatal("clone should equal the original dbf")
+	}
+	count := clone.Count()
+	dbf.Add(element1)
+	dbf.h[0][0]++
+	if clone.Count() != count || clone.Contains(element1) || !clone.Contains(element) {
+		t.Fatal("clone should not change when the original dbf does")
+	}
+}
+
+type errReader struct{}
+
+func (errReader) Read([]byte) (int, error) {
+	return 0, errors.New("read error")
+}
+
+func TestAddReader(t *testing.T) {
+	dbf := NewDbf(100, 0.1, []byte("seed"))
+	other := NewDbf(100, 0.1, []byte("seed"))
+	element := bytes.Repeat([]byte("something"), 10000)
+	if err := dbf.AddReader(bytes.NewReader(element)); err != nil {
+		t.Fatal(err)
+	}
+	other.Add(element)
+	if !dbf.Contains(element) || !dbf.Equals(other) {
+		t.Fatal("AddReader should set the same bits as Add")
+	}
+	if err := dbf.AddReader(errReader{}); err == nil {
+		t.Fatal("AddReader should return the read error")
+	}
+}
+
+func TestAddBatch(t *testing.T) {
+	var elements [][]byte
+	for i := 0; i < 100; i++ {
+		elements = append(elements, []byte(randStringBytes(8)))
+	}
+	for _, opts := range [][]Option{{WithSeed([]byte("seed"))}, {WithSeed([]byte("seed")), WithPartitioning()}} {
+		dbf := NewDbfWithOptions(100, 0.1, opts...)
+		other := NewDbfWithOptions(100, 0.1, opts...)
+		dbf.AddBatch(elements)
+		for _, elem := range elements {
+			other.Add(elem)
+		}
+		if !dbf.Equals(other) {
+			t.Fatal("AddBatch should set the same bits as Add")
+		}
+	}
+}
+
+func batchElements(n int) [][]byte {
+	elements := make([][]byte, n)
+	for i := range elements {
+		elements[i] = []byte(fmt.Sprintf("element-%d", i))
+	}
+	return elements
+}
+
+func BenchmarkContainsLoop(b *testing.B) {
+	elements := batchElements(10000)
+	dbf := NewDbf(10000, 0.01, []byte("seed"))
+	dbf.AddBatch(elements[:5000])
+	results := make([]bool, len(elements))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for j, elem := range elements {
+			results[j] = dbf.Contains(elem)
+		}
+	}
+}
+
+func BenchmarkContainsBatch(b *testing.B) {
+	elements := batchElements(10000)
+	dbf := NewDbf(10000, 0.01, []byte("seed"))
+	dbf.AddBatch(elements[:5000])
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		dbf.ContainsBatch(elements)
+	}
+}
+
+func BenchmarkAddLoop(b *testing.B) {
+	elements := batchElements(10000)
+	dbf := NewDbf(10000, 0.01, []byte("seed"))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, elem := range elements {
+			dbf.Add(elem)
+		}
+	}
+}
+
+func BenchmarkAddBatch(b *testing.B) {
+	elements := batchElements(10000)
+	dbf := NewDbf(10000, 0.01, []byte("seed"))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		dbf.AddBatch(elements)
+	}
+}
+
+func TestCapacity(t *testing.T) {
+	for _, n := range []uint{10, 100, 1000, 100000} {
+		for _, fpr := range []float64{0.5, 0.1, 0.01, 0.001} {
+			m, k := EstimateParameters(n, fpr)
+			capacity := Capacity(m, k, fpr)
+			if math.Abs(float64(capacity)-float64(n)) > 0.15*float64(n) {
+				t.Fatalf("capacity %d of m=%d k=%d is too far from n=%d", capacity, m, k, n)
+			}
+			m1, k1 := EstimateParameters(capacity, fpr)
+			if math.Abs(float64(m1)-float64(m)) > 0.15*float64(m) || math.Abs(float64(k1)-float64(k)) > 1 {
+				t.Fatalf("parameters m=%d k=%d of the capacity are too far from m=%d k=%d", m1, k1, m, k)
+			}
+		}
+	}
+}
+
+func TestNewDbfChecked(t *testing.T) {
+	dbf, err := NewDbfChecked(100, 0.1, []byte("seed"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !dbf.Equals(NewDbf(100, 0.1, []byte("seed"))) {
+		t.Fatal("checked dbf should equal NewDbf")
+	}
+	tests := []struct {
+		n    uint
+		fpr  float64
+		seed []byte
+	}{
+		{0, 0.1, []byte("seed")},
+		{100, 0, []byte("seed")},
+		{100, 1, []byte("seed")},
+		{100, -0.1, []byte("seed")},
+		{100, math.NaN(), []byte("seed")},
+		{100, 0.1, nil},
+	}
+	for _, tt := range tests {
+		if _, err := NewDbfChecked(tt.n, tt.fpr, tt.seed); err == nil {
+			t.Fatalf("n=%d fpr=%v seed=%q should fail", tt.n, tt.fpr, tt.seed)
+		}
+	}
+}
+
+func TestElementIndices(t *testing.T) {
+	dbf := NewDbf(100, 0.1, []byte("seed"))
+	for i := 0; i < 10; i++ {
+		element := []byte(randStringBytes(8))
+		assert.Equal(t, dbf.GetElementIndices(element), ElementIndices(element, dbf.m, dbf.k, []byte("seed")))
+	}
+}
+
+func TestPreviewAdd(t *testing.T) {
+	dbf := NewDbf(100, 0.1, []byte("seed"))
+	for i := 0; i < 50; i++ {
+		element := []byte(randStringBytes(8))
+		count := dbf.Count()
+		indices, newBits := dbf.PreviewAdd(element)
+		assert.Equal(t, dbf.GetElementIndices(element), indices)
+		if dbf.Count() != count {
+			t.Fatal("PreviewAdd should not change the dbf")
+		}
+		dbf.Add(element)
+		if dbf.Count() != count+newBits {
+			t.Fatal("Add should flip as many bits as PreviewAdd reported")
+		}
+		if _, newBits := dbf.PreviewAdd(element); newBits != 0 {
+			t.Fatal("adding an element again should not flip any bits")
+		}
+	}
+}
+
+func TestEstimateParametersChecked(t *testing.T) {
+	m, k, err := EstimateParametersChecked(100, 0.1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m1, k1 := EstimateParameters(100, 0.1)
+	if m != m1 || k != k1 {
+		t.Fatal("checked parameters should equal EstimateParameters")
+	}
+	// with fpr=0.5, m = n/ln(2), so n = 2977044471 is the largest n with m < 2^32
+	if m, _, err := estimateParametersChecked(2977044471, 0.5, 32); err != nil || m != math.MaxUint32 {
+		t.Fatalf("m=%d should be the maximum 32 bit uint, err=%v", m, err)
+	}
+	if _, _, err := estimateParametersChecked(2977044472, 0.5, 32); err == nil {
+		t.Fatal("m overflowing a 32 bit uint should fail")
+	}
+	if _, _, err := estimateParametersChecked(math.MaxUint32, 0.01, 32); err == nil {
+		t.Fatal("m overflowing a 32 bit uint should fail")
+	}
+	if _, _, err := estimateParametersChecked(math.MaxUint32, 0.01, 64); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := EstimateParametersChecked(0, 0.1); err == nil {
+		t.Fatal("n=0 should fail")
+	}
+	if _, _, err := EstimateParametersChecked(100, 1); err == nil {
+		t.Fatal("fpr=1 should fail")
+	}
+}
+
+func TestString(t *testing.T) {
+	dbf := NewDbfWithParams(1000, 4, []byte("seed"))
+	for i := uint(0); i < 247; i++ {
+		dbf.b.Set(i)
+	}
+	fp := dbf.SeedFingerprint()
+	want := fmt.Sprintf("DistBF{m=1000 k=4 set=247 fill=24.7%% seed=%x}", fp[:3])
+	assert.Equal(t, want, dbf.String())
+	assert.Equal(t, want, fmt.Sprint(dbf))
+}
+
+func TestAppendBitIndices(t *testing.T) {
+	dbf := NewDbf(100, 0.1, []byte("seed"))
+	dbf.Add([]byte("something"))
+	dbf.Add([]byte("something else"))
+	prefix := []uint{1000}
+	assert.Equal(t, append(prefix, dbf.GetBitIndices()...), dbf.AppendBitIndices([]uint{1000}))
+}
+
+func BenchmarkGetBitIndices(b *testing.B) {
+	dbf := NewDbf(10000, 0.01, []byte("seed"))
+	dbf.AddBatch(batchElements(10000))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		dbf.GetBitIndices()
+	}
+}
+
+func BenchmarkAppendBitIndices(b *testing.B) {
+	dbf := NewDbf(10000, 0.01, []byte("seed"))
+	dbf.AddBatch(batchElements(10000))
+	var indices []uint
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		indices = dbf.AppendBitIndices(indices[:0])
+	}
+}
+
+func TestNewDbfFromBitIndices(t *testing.T) {
+	dbf := NewDbf(1000, 0.01, []byte("seed"))
+	dbf.AddBatch(batchElements(20))
+	reconstructed, err := NewDbfFromBitIndices(dbf.m, dbf.k, []byte("seed"), dbf.GetBitIndices())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reconstructed.Equals(dbf) {
+		t.Fatal("dbf reconstructed from its bit indices should equal the original")
+	}
+	if _, err := NewDbfFromBitIndices(dbf.m, dbf.k, []byte("seed"), []uint{1, dbf.m}); err == nil {
+		t.Fatal("an index not below m should fail")
+	}
+	if _, err := NewDbfFromBitIndices(0, dbf.k, []byte("seed"), nil); err == nil {
+		t.Fatal("m of 0 should fail")
+	}
+}
+
+func TestGetBitIndicesSorted(t *testing.T) {
+	dbf := NewDbf(1000, 0.01, []byte("seed"))
+	r := rand.New(rand.NewSource(1))
+	for _, i := range r.Perm(200) {
+		dbf.Add([]byte(fmt.Sprintf("element-%d", i)))
+	}
+	indices := dbf.GetBitIndices()
+	for i := 1; i < len(indices); i++ {
+		if indices[i-1] >= indices[i] {
+			t.Fatal("bit indices should be in ascending order")
+		}
+	}
+}
+
+func TestForEachSetBit(t *testing.T) {
+	dbf := NewDbf(1000, 0.01, []byte("seed"))
+	dbf.AddBatch(batchElements(200))
+	var visited []uint
+	dbf.ForEachSetBit(func(index uint) bool {
+		visited = append(visited, index)
+		return true
+	})
+	assert.Equal(t, dbf.GetBitIndices(), visited)
+	visited = visited[:0]
+	dbf.ForEachSetBit(func(index uint) bool {
+		visited = append(visited, index)
+		return len(visited) < 3
+	})
+	assert.Equal(t, dbf.GetBitIndices()[:3], visited)
+	NewDbf(1000, 0.01, []byte("seed")).ForEachSetBit(func(uint) bool {
+		t.Fatal("empty dbf has no set bits")
+		return true
+	})
+}
+
+func TestWords(t *testing.T) {
+	dbf := NewDbf(100, 0.1, []byte("seed"))
+	dbf.Add([]byte("something"))
+	words := dbf.Words()
+	assert.Equal(t, int((dbf.m+63)/64), len(words))
+	for i := uint(0); i < uint(len(words))*64; i++ {
+		set := words[i/64]&(1<<(i%64)) != 0
+		if set != dbf.b.Test(i) {
+			t.Fatalf("bit %d of the words should match the bit array", i)
+		}
+	}
+}
+
+func TestBitArrayBytes(t *testing.T) {
+	dbf := NewDbf(100, 0.1, []byte("seed"))
+	dbf.Add([]byte("something"))
+	data := dbf.BitArrayBytes()
+	assert.Equal(t, int((dbf.m+7)/8), len(data))
+	for i := uint(0); i < uint(len(data))*8; i++ {
+		if set := data[i/8]&(1<<(i%8)) != 0; set != dbf.b.Test(i) {
+			t.Fatalf("bit %d of the bytes should match the bit array", i)
+		}
+	}
+	data[0] ^= 0xff
+	if data[0] == dbf.BitArrayBytes()[0] {
+		t.Fatal("BitArrayBytes should return a copy")
+	}
+}
+
+func TestExportBitIndices(t *testing.T) {
+	dbf := NewDbf(1000, 0.01, []byte("seed"))
+	elements := batchElements(100)
+	dbf.AddBatch(elements)
+	indices := dbf.ExportBitIndices()
+	assert.Equal(t, dbf.GetBitIndices(), indices)
+	// move the bits into a willf/bloom filter with room for m bits
+	words := make([]uint64, (dbf.m+63)/64)
+	for _, i := range indices {
+		words[i/64] |= 1 << (i % 64)
+	}
+	f := bloom.From(words, dbf.k)
+	for _, elem := range elements {
+		var locations []uint64
+		for _, i := range dbf.GetElementIndices(elem) {
+			locations = append(locations, uint64(i))
+		}
+		if !f.TestLocations(locations) {
+			t.Fatal("the exported bits should be set at the same positions of the willf/bloom filter")
+		}
+	}
+}
+
+func TestMembership(t *testing.T) {
+	dbf := NewDbf(1000, 0.01, []byte("seed"))
+	elements := batchElements(2000)
+	dbf.AddBatch(elements[:1000])
+	for _, elem := range elements[:1000] {
+		assert.Equal(t, 1.0, dbf.Membership(elem))
+	}
+	below := 0
+	for _, elem := range elements[1000:] {
+		score := dbf.Membership(elem)
+		if score < 0 || score > 1 {
+			t.Fatalf("membership %f should be between 0 and 1", score)
+		}
+		if score < 1 {
+			below++
+		}
+	}
+	if below < 950 {
+		t.Fatalf("only %d of 1000 elements that were not added scored below 1", below)
+	}
+}
+
+func TestAddString(t *testing.T) {
+	dbf := NewDbf(100, 0.1, []byte("seed"))
+	other := NewDbf(100, 0.1, []byte("seed"))
+	dbf.AddString("something")
+	other.Add([]byte("something"))
+	if !dbf.Equals(other) {
+		t.Fatal("AddString should set the same bits as Add")
+	}
+	if !dbf.ContainsString("something") || dbf.ContainsString("something else") {
+		t.Fatal("ContainsString should match Contains")
+	}
+	// longer than the chunks s is hashed in, and not a multiple of them
+	long := strings.Repeat("long element ", 1000)
+	dbf.AddString(long)
+	other.Add([]byte(long))
+	if !dbf.Equals(other) || !dbf.ContainsString(long) {
+		t.Fatal("AddString of a long string should set the same bits as Add")
+	}
+}
+
+func TestAddStringAllocs(t *testing.T) {
+	hashes := map[string][]Option{
+		"default": {WithSeed([]byte("seed"))},
+		"keyed":   {WithSeed([]byte("seed")), WithKeyedHash([]byte("key"))},
+	}
+	for name, opts := range hashes {
+		dbf := NewDbfWithOptions(100, 0.1, opts...)
+		s := strings.Repeat("long element ", 1000)
+		element := []byte(s)
+		add := testing.AllocsPerRun(100, func() { dbf.Add(element) })
+		addString := testing.AllocsPerRun(100, func() { dbf.AddString(s) })
+		if addString > add {
+			t.Fatalf("%s: AddString should allocate no more than Add of the bytes, got %v and %v", name, addString, add)
+		}
+		contains := testing.AllocsPerRun(100, func() { dbf.Contains(element) })
+		containsString := testing.AllocsPerRun(100, func() { dbf.ContainsString(s) })
+		if containsString > contains {
+			t.Fatalf("%s: ContainsString should allocate no more than Contains of the bytes, got %v and %v", name,
+				containsString, contains)
+		}
+	}
+}
+
+func TestRebuildWithSeed(t *testing.T) {
+	dbf := NewDbf(100, 0.1, []byte("seed"))
+	elements := batchElements(50)
+	dbf.AddBatch(elements)
+	rebuilt := dbf.RebuildWithSeed([]byte("new seed"), elements)
+	if !rebuilt.ContainsAll(elements) {
+		t.Fatal("rebuilt dbf should contain all elements")
+	}
+	if rebuilt.b.Equal(dbf.b) {
+		t.Fatal("rebuilt dbf should have a different bit pattern")
+	}
+	fresh := NewDbf(100, 0.1, []byte("new seed"))
+	fresh.AddBatch(elements)
+	if !rebuilt.Equals(fresh) {
+		t.Fatal("rebuilt dbf should equal a new dbf with the new seed holding the elements")
+	}
+	if !dbf.ContainsAll(elements) || dbf.SeedFingerprint() != NewDbf(1, 0.5, []byte("seed")).SeedFingerprint() {
+		t.Fatal("rebuilding should not change the original dbf")
+	}
+}
+
+func TestContainsDebug(t *testing.T) {
+	dbf := NewDbf(100, 0.1, []byte("seed"))
+	element := []byte("something")
+	present, missing := dbf.ContainsDebug(element)
+	if present {
+		t.Fatal("empty dbf should not contain the element")
+	}
+	indices := dbf.GetElementIndices(element)
+	for _, index := range missing {
+		if !containsIndex(indices, index) {
+			t.Fatal("missing index should be an index of the element")
+		}
+	}
+	dbf.BitArray().Set(indices[0])
+	before := dbf.BitArray().Clone()
+	present, missing = dbf.ContainsDebug(element)
+	if present || containsIndex(missing, indices[0]) {
+		t.Fatal("set index should not be reported missing")
+	}
+	if !dbf.BitArray().Equal(before) {
+		t.Fatal("ContainsDebug should not mutate the dbf")
+	}
+	dbf.Add(element)
+	present, missing = dbf.ContainsDebug(element)
+	assert.True(t, present)
+	assert.Empty(t, missing)
+}
+
+func TestValidate(t *testing.T) {
+	dbf := NewDbf(1000, 0.01, []byte("seed"))
+	dbf.Add([]byte("something"))
+	if err := dbf.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := dbf.MarshalBinaryCompressed()
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded := NewDbf(10, 0.1, []byte("other"))
+	if err := decoded.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := decoded.Validate(); err != nil {
+		t.Fatalf("decoded dbf should be valid: %v", err)
+	}
+	if err := NewDbfWithOptions(1000, 0.01, WithSeed([]byte("seed")), WithLazySeedHashes()).Validate(); err != nil {
+		t.Fatalf("dbf with lazy seed hashes should be valid: %v", err)
+	}
+
+	broken := map[string]func(d *DistBF){
+		"m is 0":                      func(d *DistBF) { d.m = 0 },
+		"k is 0":                      func(d *DistBF) { d.k = 0 },
+		"too few seed hashes":         func(d *DistBF) { d.h = d.h[:len(d.h)-1] },
+		"too many seed hashes":        func(d *DistBF) { d.h = append(d.h, d.h[0]) },
+		"short seed hash":             func(d *DistBF) { d.h[1] = d.h[1][:16] },
+		"missing bit array":           func(d *DistBF) { d.b = nil },
+		"bit array too short":         func(d *DistBF) { d.b = bitset.New(d.m - 1) },
+		"bit array too long":          func(d *DistBF) { d.b = bitset.New(d.m + 64) },
+		"bits beyond m":               func(d *DistBF) { d.b.Bytes()[len(d.b.Bytes())-1] = ^uint64(0) },
+		"partitioned m below k":       func(d *DistBF) { d.partitioned = true; d.m = d.k - 1 },
+		"seed hashes of another hash": func(d *DistBF) { d.hf = sha256.New224 },
+	}
+	for name, breakIt := range broken {
+		d := dbf.Clone()
+		breakIt(d)
+		if err := d.Validate(); err == nil {
+			t.Fatalf("%s: Validate should fail", name)
+		}
+	}
+}
+
+func TestContainsConstantTime(t *testing.T) {
+	dbf := NewDbf(1000, 0.1, []byte("seed"))
+	elements := batchElements(2000)
+	for _, elem := range elements[:1000] {
+		dbf.Add(elem)
+	}
+	positives := 0
+	for _, elem := range elements {
+		contains := dbf.Contains(elem)
+		if dbf.ContainsConstantTime(elem) != contains {
+			t.Fatalf("ContainsConstantTime(%q) should equal Contains %v", elem, contains)
+		}
+		if contains {
+			positives++
+		}
+	}
+	if positives < 1000 || positives == len(elements) {
+		t.Fatalf("test needs both positive and negative elements, got %d positives", positives)
+	}
+	if (&DistBF{}).ContainsConstantTime([]byte("something")) {
+		t.Fatal("an empty dbf should not contain anything")
+	}
+	short := bitset.New(10)
+	for i := uint(0); i < 10; i++ {
+		short.Set(i)
+	}
+	dbf.SetBitSet(short)
+	for _, elem := range elements {
+		if dbf.ContainsConstantTime(elem) != dbf.Contains(elem) {
+			t.Fatalf("ContainsConstantTime(%q) should equal Contains on a bit array shorter than m", elem)
+		}
+	}
+}
+
+type testKey struct {
+	tenant string
+	id     uint64
+}
+
+// EncodeKey length prefixes tenant so that no two keys share an encoding
+func (k testKey) EncodeKey() []byte {
+	data := make([]byte, 4, 4+len(k.tenant)+8)
+	binary.BigEndian.PutUint32(data, uint32(len(k.tenant)))
+	data = append(data, k.tenant...)
+	return append(data, uint64Element(k.id)...)
+}
+
+func TestAddKey(t *testing.T) {
+	dbf := NewDbf(1000, 0.01, []byte("seed"))
+	key := testKey{tenant: "acme", id: 42}
+	dbf.AddKey(key)
+	if !dbf.ContainsKey(key) || !dbf.ContainsKey(testKey{tenant: "acme", id: 42}) {
+		t.Fatal("added key should be contained in dbf")
+	}
+	if !dbf.Contains(key.EncodeKey()) {
+		t.Fatal("AddKey should add the encoding of the key")
+	}
+	if dbf.ContainsKey(testKey{tenant: "acme", id: 43}) || dbf.ContainsKey(testKey{tenant: "other", id: 42}) {
+		t.Fatal("other keys should not be contained in dbf")
+	}
+}
+
+func TestElementFingerprint(t *testing.T) {
+	dbf := NewDbf(1000, 0.01, []byte("seed"))
+	peer := NewDbf(1000, 0.01, []byte("seed"))
+	element := []byte("something")
+	fp := dbf.ElementFingerprint(element)
+	if fp != dbf.ElementFingerprint(element) || fp != peer.ElementFingerprint([]byte("something")) {
+		t.Fatal("the fingerprint should be stable for the same element and seed")
+	}
+	if fp == dbf.ElementFingerprint([]byte("something else")) {
+		t.Fatal("different elements should have different fingerprints")
+	}
+	if fp == NewDbf(1000, 0.01, []byte("other seed")).ElementFingerprint(element) {
+		t.Fatal("different seeds should give different fingerprints")
+	}
+	// with an even k an XOR fold would not depend on the element
+	even := NewDbfWithParams(1000, 4, []byte("seed"))
+	if even.ElementFingerprint(element) == even.ElementFingerprint([]byte("something else")) {
+		t.Fatal("the fingerprint should depend on the element for even k")
 	}
 }
@@ -0,0 +1,57 @@
+package DBF
+
+import (
+	"container/list"
+	"sync"
+)
+
+// indexCache is a least recently used cache of element indices keyed by the element hash, safe for
+// concurrent use so it works under the read lock of ConcurrentDistBF
+type indexCache struct {
+	mu      sync.Mutex
+	size    int
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+type indexCacheEntry struct {
+	digest  string
+	indices []uint
+}
+
+func newIndexCache(size int) *indexCache {
+	return &indexCache{size: size, order: list.New(), entries: make(map[string]*list.Element, size)}
+}
+
+// get returns the cached indices of the element with the given hash, callers must not modify them
+func (c *indexCache) get(digest []byte) ([]uint, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[string(digest)]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(e)
+	return e.Value.(*indexCacheEntry).indices, true
+}
+
+// add caches the indices of the element with the given hash, evicting the least recently used entry if full
+func (c *indexCache) add(digest []byte, indices []uint) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.entries[string(digest)]; ok {
+		return
+	}
+	if c.order.Len() >= c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*indexCacheEntry).digest)
+	}
+	entry := &indexCacheEntry{digest: string(digest), indices: indices}
+	c.entries[entry.digest] = c.order.PushFront(entry)
+}
+
+// empty returns a new empty cache of the same size
+func (c *indexCache) empty() *indexCache {
+	return newIndexCache(c.size)
+}
@@ -0,0 +1,76 @@
+package DBF
+
+import (
+	"math/rand"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func TestWithIndexCache(t *testing.T) {
+	dbf := NewDbf(1000, 0.01, []byte("seed"))
+	cached := NewDbfWithOptions(1000, 0.01, WithSeed([]byte("seed")), WithIndexCache(10))
+	elements := batchElements(50)
+	for round := 0; round < 3; round++ {
+		for _, elem := range elements {
+			if !reflect.DeepEqual(dbf.GetElementIndices(elem), cached.GetElementIndices(elem)) {
+				t.Fatal("cached indices should equal the computed ones")
+			}
+			dbf.Add(elem)
+			cached.Add(elem)
+		}
+	}
+	if !cached.Equals(dbf) {
+		t.Fatal("the cache should not change the bits set by Add")
+	}
+	if cached.cache.order.Len() != 10 || len(cached.cache.entries) != 10 {
+		t.Fatal("the cache should hold at most its size")
+	}
+	// modifying the returned indices must not corrupt the cache
+	indices := cached.GetElementIndices(elements[49])
+	indices[0]++
+	if !reflect.DeepEqual(dbf.GetElementIndices(elements[49]), cached.GetElementIndices(elements[49])) {
+		t.Fatal("returned indices should not share the cache")
+	}
+	// a new seed or size invalidates the cache
+	rebuilt := cached.RebuildWithSeed([]byte("other"), nil)
+	if !reflect.DeepEqual(NewDbf(1000, 0.01, []byte("other")).GetElementIndices(elements[0]), rebuilt.GetElementIndices(elements[0])) {
+		t.Fatal("rebuilt dbf should not use indices cached for the old seed")
+	}
+	cached.Resize(10, 0.1)
+	if !reflect.DeepEqual(NewDbf(10, 0.1, []byte("seed")).GetElementIndices(elements[0]), cached.GetElementIndices(elements[0])) {
+		t.Fatal("resized dbf should not use indices cached for the old size")
+	}
+}
+
+// skewedQueries returns n element indices out of universe drawn from a zipf distribution
+func skewedQueries(n, universe int) [][]byte {
+	r := rand.New(rand.NewSource(1))
+	zipf := rand.NewZipf(r, 1.2, 1, uint64(universe-1))
+	queries := make([][]byte, n)
+	for i := range queries {
+		queries[i] = []byte("element-" + strconv.FormatUint(zipf.Uint64(), 10))
+	}
+	return queries
+}
+
+// the benchmarks use k=20, the index cache saves little next to hashing the element for small k
+func BenchmarkContainsSkewed(b *testing.B) {
+	queries := skewedQueries(10000, 100000)
+	dbf := NewDbf(100000, 0.000001, []byte("seed"))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		dbf.Contains(queries[i%len(queries)])
+	}
+}
+
+func BenchmarkContainsSkewedIndexCache(b *testing.B) {
+	queries := skewedQueries(10000, 100000)
+	dbf := NewDbfWithOptions(100000, 0.000001, WithSeed([]byte("seed")), WithIndexCache(1000))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		dbf.Contains(queries[i%len(queries)])
+	}
+}
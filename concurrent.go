@@ -0,0 +1,126 @@
+package DBF
+
+import (
+	"crypto/sha512"
+	"sync"
+	"sync/atomic"
+)
+
+// ConcurrentDistBF guards a DBF so that it can be shared between goroutines,
+// Add takes the write lock and Contains takes the read lock
+type ConcurrentDistBF struct {
+	mu  sync.RWMutex
+	dbf *DistBF
+}
+
+// NewConcurrentDbf wraps dbf, which must not be used directly afterwards
+func NewConcurrentDbf(dbf *DistBF) *ConcurrentDistBF {
+	return &ConcurrentDistBF{dbf: dbf}
+}
+
+// Add element to DBF
+func (c *ConcurrentDistBF) Add(element []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.dbf.Add(element)
+}
+
+// Contains returns true if element is probably in DBF, false if it is definitely not
+func (c *ConcurrentDistBF) Contains(element []byte) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.dbf.Contains(element)
+}
+
+// AtomicDistBF shares a DBF between goroutines without a lock, Add sets bits with an atomic
+// compare and swap on the bit array words and Contains reads them atomically.
+// Since bits only go from 0 to 1 an element is contained as soon as its Add returns.
+type AtomicDistBF struct {
+	dbf *DistBF
+}
+
+// NewAtomicDbf wraps dbf, which must not be used directly afterwards
+func NewAtomicDbf(dbf *DistBF) *AtomicDistBF {
+	// bits are set without a lock, so the summary could not be kept in sync
+	dbf.dropSummary()
+	return &AtomicDistBF{dbf: dbf}
+}
+
+// Add element to DBF
+func (a *AtomicDistBF) Add(element []byte) {
+	a.dbf.mustBeMutable()
+	a.dbf.countAdds(1)
+	words := a.dbf.b.Bytes()
+	digest := hashElement(a.dbf.hashFunc(), element)
+	a.dbf.auditAdd(digest)
+	for _, location := range a.dbf.digestIndices(digest) {
+		setBitAtomic(words, location)
+	}
+}
+
+// Contains returns true if element is probably in DBF, false if it is definitely not
+func (a *AtomicDistBF) Contains(element []byte) bool {
+	a.dbf.countQueries(1)
+	words := a.dbf.b.Bytes()
+	for _, location := range a.dbf.elementIndices(element) {
+		if !testBitAtomic(words, location) {
+			return false
+		}
+	}
+	return true
+}
+
+// AddBatchParallel adds elements to DBF like AddBatch, splitting them between the given number of goroutines
+// that set the bits atomically. dbf must not be used concurrently until it returns.
+func (dbf *DistBF) AddBatchParallel(elements [][]byte, workers int) {
+	dbf.mustBeMutable()
+	if workers < 1 {
+		workers = 1
+	}
+	if workers > len(elements) {
+		workers = len(elements)
+	}
+	dbf.dropSummary()
+	dbf.countAdds(len(elements))
+	words := dbf.b.Bytes()
+	// the workers fill in the fingerprints by position so the audit log keeps the order of elements
+	var fingerprints [][sha512.Size256]byte
+	if dbf.audit != nil {
+		fingerprints = make([][sha512.Size256]byte, len(elements))
+	}
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		start := w * len(elements) / workers
+		shard := elements[start : (w+1)*len(elements)/workers]
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			dbf.batchIndices(shard, func(i int, digest []byte, locations []uint) {
+				if fingerprints != nil {
+					fingerprints[start+i] = dbf.digestFingerprint(digest)
+				}
+				for _, location := range locations {
+					setBitAtomic(words, location)
+				}
+			})
+		}()
+	}
+	wg.Wait()
+	dbf.auditAdds(fingerprints...)
+}
+
+// setBitAtomic sets bit i of words, retrying if another goroutine changed its word concurrently
+func setBitAtomic(words []uint64, i uint) {
+	addr := &words[i/64]
+	mask := uint64(1) << (i % 64)
+	for {
+		old := atomic.LoadUint64(addr)
+		if old&mask != 0 || atomic.CompareAndSwapUint64(addr, old, old|mask) {
+			return
+		}
+	}
+}
+
+func testBitAtomic(words []uint64, i uint) bool {
+	return atomic.LoadUint64(&words[i/64])&(uint64(1)<<(i%64)) != 0
+}
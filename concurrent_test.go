@@ -0,0 +1,122 @@
+package DBF
+
+import (
+	"encoding/binary"
+	"fmt"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// run with -race to detect unsynchronized access
+func TestConcurrentDistBF(t *testing.T) {
+	c := NewConcurrentDbf(NewDbf(1000, 0.01, []byte("seed")))
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				element := []byte(fmt.Sprintf("element-%d-%d", g, i))
+				c.Add(element)
+				if !c.Contains(element) {
+					t.Error("added element should be contained in dbf")
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+	for g := 0; g < 8; g++ {
+		for i := 0; i < 100; i++ {
+			if !c.Contains([]byte(fmt.Sprintf("element-%d-%d", g, i))) {
+				t.Fatal("added element should be contained in dbf")
+			}
+		}
+	}
+}
+
+// run with -race to detect unsynchronized access
+func TestAtomicDistBF(t *testing.T) {
+	dbf := NewDbf(1000, 0.01, []byte("seed"))
+	a := NewAtomicDbf(dbf)
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				element := []byte(fmt.Sprintf("element-%d-%d", g, i))
+				a.Add(element)
+				if !a.Contains(element) {
+					t.Error("added element should be contained in dbf")
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+	serial := NewDbf(1000, 0.01, []byte("seed"))
+	for g := 0; g < 8; g++ {
+		for i := 0; i < 100; i++ {
+			serial.Add([]byte(fmt.Sprintf("element-%d-%d", g, i)))
+		}
+	}
+	if !serial.Equals(dbf) {
+		t.Fatal("atomic adds should set the same bits as serial adds")
+	}
+}
+
+// benchmarkParallelAdds calls add from parallel goroutines with a distinct element per iteration, so the adds
+// keep setting new bits instead of finding them all set after the first one
+func benchmarkParallelAdds(b *testing.B, add func(element []byte)) {
+	var goroutines uint64
+	b.RunParallel(func(pb *testing.PB) {
+		g := atomic.AddUint64(&goroutines, 1)
+		elem := make([]byte, 8)
+		for i := uint64(0); pb.Next(); i++ {
+			binary.BigEndian.PutUint64(elem, g<<40|i)
+			add(elem)
+		}
+	})
+}
+
+func BenchmarkConcurrentAdd(b *testing.B) {
+	c := NewConcurrentDbf(NewDbf(uint(b.N)+1, 0.01, []byte("seed")))
+	benchmarkParallelAdds(b, c.Add)
+}
+
+func BenchmarkAtomicAdd(b *testing.B) {
+	a := NewAtomicDbf(NewDbf(uint(b.N)+1, 0.01, []byte("seed")))
+	benchmarkParallelAdds(b, a.Add)
+}
+
+func TestAddBatchParallel(t *testing.T) {
+	elements := batchElements(10000)
+	serial := NewDbf(10000, 0.01, []byte("seed"))
+	serial.AddBatch(elements)
+	for _, workers := range []int{0, 1, 3, 8, 20000} {
+		parallel := NewDbf(10000, 0.01, []byte("seed"))
+		parallel.AddBatchParallel(elements, workers)
+		if !parallel.Equals(serial) {
+			t.Fatalf("AddBatchParallel with %d workers should set the same bits as AddBatch", workers)
+		}
+	}
+}
+
+func BenchmarkAddBatchSerial1M(b *testing.B) {
+	elements := batchElements(1000000)
+	dbf := NewDbf(1000000, 0.01, []byte("seed"))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		dbf.AddBatch(elements)
+	}
+}
+
+func BenchmarkAddBatchParallel1M(b *testing.B) {
+	elements := batchElements(1000000)
+	dbf := NewDbf(1000000, 0.01, []byte("seed"))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		dbf.AddBatchParallel(elements, runtime.GOMAXPROCS(0))
+	}
+}
@@ -0,0 +1,161 @@
+package DBF
+
+import (
+	"bytes"
+	"crypto/sha512"
+	"fmt"
+	"hash"
+)
+
+// CountingDistBF is a DBF variant that keeps a counter instead of a bit at each of the m locations, so
+// elements can be removed again. Counters are 8 bits unless set by WithCounterWidth. A counter saturates at
+// its maximum: it is not incremented further and Remove leaves it untouched, since the number of elements
+// mapped to it is unknown. Removing elements mapped to a saturated counter is unreliable from then on.
+type CountingDistBF struct {
+	c     []byte
+	width uint
+	m     uint
+	k     uint
+	h     [][]byte
+	s     []byte
+	hf    func() hash.Hash
+}
+
+// CountingOption configures a counting DBF in NewCountingDbf
+type CountingOption func(*CountingDistBF)
+
+// WithCounterWidth sets the bits per counter to 4, 8 or 16, so counters saturate at 15, 255 or 65535
+func WithCounterWidth(bits uint) CountingOption {
+	return func(c *CountingDistBF) {
+		c.width = bits
+	}
+}
+
+// NewCountingDbf returns the counting DBF with the same m, k and mapping as NewDbf,
+// it panics if a counter width other than 4, 8 or 16 is set
+func NewCountingDbf(n uint, fpr float64, s []byte, opts ...CountingOption) *CountingDistBF {
+	m, k := EstimateParameters(n, fpr)
+	c := &CountingDistBF{
+		width: 8,
+		m:     m,
+		k:     k,
+		h:     seedHashes(sha512.New512_256, s, k),
+		s:     append([]byte(nil), s...),
+		hf:    sha512.New512_256,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.width != 4 && c.width != 8 && c.width != 16 {
+		panic("DBF: counter width must be 4, 8 or 16 bits")
+	}
+	c.c = make([]byte, (m*c.width+7)/8)
+	return c
+}
+
+// GetElementIndices returns the counter indices an element maps to, the same as for a DBF with equal parameters
+func (c *CountingDistBF) GetElementIndices(element []byte) []uint {
+	return hashesModulo(c.m, addElementHash(c.hf, element, c.h))
+}
+
+// Add element to the counting DBF
+func (c *CountingDistBF) Add(element []byte) {
+	max := c.max()
+	for _, location := range c.GetElementIndices(element) {
+		if v := c.counter(location); v < max {
+			c.setCounter(location, v+1)
+		}
+	}
+}
+
+// Remove element from the counting DBF, counters stay at zero.
+// Removing an element that was never added can remove other elements.
+func (c *CountingDistBF) Remove(element []byte) {
+	max := c.max()
+	for _, location := range c.GetElementIndices(element) {
+		if v := c.counter(location); v > 0 && v < max {
+			c.setCounter(location, v-1)
+		}
+	}
+}
+
+// Contains returns true if all k counters of element are nonzero
+func (c *CountingDistBF) Contains(element []byte) bool {
+	for _, location := range c.GetElementIndices(element) {
+		if c.counter(location) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// MergeAdd adds the counters of other to the counting DBF, saturating them at their maximum, so a counter holds
+// how many times its location was set across both. Both need the same m, k, counter width and seed.
+func (c *CountingDistBF) MergeAdd(other *CountingDistBF) error {
+	if c.m != other.m || c.k != other.k || c.width != other.width {
+		return fmt.Errorf("%w: m=%d k=%d width=%d does not match m=%d k=%d width=%d",
+			ErrIncompatibleParams, other.m, other.k, other.width, c.m, c.k, c.width)
+	}
+	if !bytes.Equal(c.s, other.s) {
+		return fmt.Errorf("%w: seeds differ", ErrSeedMismatch)
+	}
+	max := c.max()
+	for i := uint(0); i < c.m; i++ {
+		sum := uint32(c.counter(i)) + uint32(other.counter(i))
+		if sum > uint32(max) {
+			sum = uint32(max)
+		}
+		c.setCounter(i, uint16(sum))
+	}
+	return nil
+}
+
+// EstimateFrequency returns the smallest of the k counters of element, an upper bound of how often it was
+// added unless counters saturated
+func (c *CountingDistBF) EstimateFrequency(element []byte) uint {
+	min := uint(c.max())
+	for _, location := range c.GetElementIndices(element) {
+		if v := uint(c.counter(location)); v < min {
+			min = v
+		}
+	}
+	return min
+}
+
+// Estimate returns EstimateFrequency(element), the count-min readout of how often element was added. It only
+// over-estimates: every add of element raised all its k counters, while other elements may have raised some
+// of them too. The guarantee holds unless a counter saturated, or an element that was not added was removed.
+func (c *CountingDistBF) Estimate(element []byte) uint {
+	return c.EstimateFrequency(element)
+}
+
+// max returns the value at which counters saturate
+func (c *CountingDistBF) max() uint16 {
+	return uint16(1<<c.width - 1)
+}
+
+// counter returns counter i, 4 bit counters are packed two per byte with the even one in the low nibble
+// and 16 bit counters take two bytes, big endian
+func (c *CountingDistBF) counter(i uint) uint16 {
+	switch c.width {
+	case 4:
+		return uint16(c.c[i/2]>>(4*(i%2))) & 0xf
+	case 16:
+		return uint16(c.c[2*i])<<8 | uint16(c.c[2*i+1])
+	default:
+		return uint16(c.c[i])
+	}
+}
+
+func (c *CountingDistBF) setCounter(i uint, v uint16) {
+	switch c.width {
+	case 4:
+		shift := 4 * (i % 2)
+		c.c[i/2] = c.c[i/2]&^(0xf<<shift) | byte(v)<<shift
+	case 16:
+		c.c[2*i] = byte(v >> 8)
+		c.c[2*i+1] = byte(v)
+	default:
+		c.c[i] = byte(v)
+	}
+}
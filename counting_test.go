@@ -0,0 +1,159 @@
+package DBF
+
+import (
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCountingDistBF(t *testing.T) {
+	c := NewCountingDbf(100, 0.1, []byte("seed"))
+	element := []byte("something")
+	element1 := []byte("something else")
+	assert.Equal(t, NewDbf(100, 0.1, []byte("seed")).GetElementIndices(element), c.GetElementIndices(element))
+	c.Add(element)
+	c.Add(element1)
+	if !c.Contains(element) || !c.Contains(element1) {
+		t.Fatal("added elements should be contained in counting dbf")
+	}
+	c.Remove(element)
+	if c.Contains(element) {
+		t.Fatal("removed element should not be contained in counting dbf")
+	}
+	if !c.Contains(element1) {
+		t.Fatal("element that was not removed should be contained in counting dbf")
+	}
+	c.Remove(element1)
+	c.Remove(element1)
+	for _, counter := range c.c {
+		if counter != 0 {
+			t.Fatal("counters should saturate at zero")
+		}
+	}
+}
+
+func TestCountingDistBFOverflow(t *testing.T) {
+	c := NewCountingDbf(100, 0.1, []byte("seed"))
+	element := []byte("something")
+	for i := 0; i < math.MaxUint8+10; i++ {
+		c.Add(element)
+	}
+	for _, location := range c.GetElementIndices(element) {
+		if c.c[location] != math.MaxUint8 {
+			t.Fatal("counters should saturate at 255")
+		}
+	}
+	for i := 0; i < math.MaxUint8+10; i++ {
+		c.Remove(element)
+	}
+	if !c.Contains(element) {
+		t.Fatal("saturated counters should not be decremented")
+	}
+}
+
+func TestCountingDistBFCounterWidth(t *testing.T) {
+	for _, width := range []uint{4, 8, 16} {
+		c := NewCountingDbf(100, 0.1, []byte("seed"), WithCounterWidth(width))
+		assert.Equal(t, int((c.m*width+7)/8), len(c.c))
+		max := int(1<<width - 1)
+		element := []byte("something")
+		other := []byte("something else")
+		c.Add(other)
+		for i := 0; i < max-1; i++ {
+			c.Add(element)
+		}
+		// one below the maximum the counters are still exact
+		c.Remove(element)
+		for _, location := range c.GetElementIndices(element) {
+			if v := int(c.counter(location)); v == max || v < max-2 {
+				t.Fatalf("width %d: counter %d should not be saturated", width, v)
+			}
+		}
+		c.Add(element)
+		c.Add(element)
+		c.Add(element)
+		for _, location := range c.GetElementIndices(element) {
+			if int(c.counter(location)) != max {
+				t.Fatalf("width %d: counters should saturate at %d", width, max)
+			}
+		}
+		for i := 0; i < max+10; i++ {
+			c.Remove(element)
+		}
+		if !c.Contains(element) {
+			t.Fatalf("width %d: saturated counters should not be decremented", width)
+		}
+		// neighbouring 4 bit counters share a byte
+		for _, location := range c.GetElementIndices(other) {
+			if c.counter(location) == 0 {
+				t.Fatalf("width %d: counters of other elements should not change", width)
+			}
+		}
+	}
+	assert.Panics(t, func() { NewCountingDbf(100, 0.1, []byte("seed"), WithCounterWidth(12)) })
+}
+
+func TestCountingDistBFMergeAdd(t *testing.T) {
+	nodes := make([]*CountingDistBF, 3)
+	for i := range nodes {
+		nodes[i] = NewCountingDbf(1000, 0.01, []byte("seed"))
+		nodes[i].Add([]byte("everywhere"))
+		if i < 2 {
+			nodes[i].Add([]byte("twice"))
+		}
+	}
+	nodes[2].Add([]byte("once"))
+	merged := NewCountingDbf(1000, 0.01, []byte("seed"))
+	for _, node := range nodes {
+		if err := merged.MergeAdd(node); err != nil {
+			t.Fatal(err)
+		}
+	}
+	assert.Equal(t, uint(3), merged.EstimateFrequency([]byte("everywhere")))
+	assert.Equal(t, uint(2), merged.EstimateFrequency([]byte("twice")))
+	assert.Equal(t, uint(1), merged.EstimateFrequency([]byte("once")))
+	assert.Equal(t, uint(0), merged.EstimateFrequency([]byte("nowhere")))
+	if !merged.Contains([]byte("once")) || merged.Contains([]byte("nowhere")) {
+		t.Fatal("Contains of the merged counting dbf should check for nonzero counters")
+	}
+
+	small := NewCountingDbf(1000, 0.01, []byte("seed"), WithCounterWidth(4))
+	for i := 0; i < 10; i++ {
+		small.Add([]byte("often"))
+	}
+	if err := small.MergeAdd(small); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, uint(15), small.EstimateFrequency([]byte("often")))
+
+	incompatible := []*CountingDistBF{
+		NewCountingDbf(2000, 0.01, []byte("seed")),
+		NewCountingDbf(1000, 0.01, []byte("seed"), WithCounterWidth(16)),
+	}
+	for _, other := range incompatible {
+		if err := merged.MergeAdd(other); !errors.Is(err, ErrIncompatibleParams) {
+			t.Fatalf("merging incompatible counting dbfs should fail with ErrIncompatibleParams, got %v", err)
+		}
+	}
+	if err := merged.MergeAdd(NewCountingDbf(1000, 0.01, []byte("other seed"))); !errors.Is(err, ErrSeedMismatch) {
+		t.Fatalf("merging counting dbfs with different seeds should fail with ErrSeedMismatch, got %v", err)
+	}
+}
+
+func TestCountingDistBFEstimate(t *testing.T) {
+	c := NewCountingDbf(100, 0.1, []byte("seed"))
+	elements := batchElements(100)
+	for i, elem := range elements {
+		for j := 0; j <= i%5; j++ {
+			c.Add(elem)
+		}
+	}
+	for i, elem := range elements {
+		if estimate := c.Estimate(elem); estimate < uint(i%5+1) {
+			t.Fatalf("estimate %d of %q should be at least the true count %d", estimate, elem, i%5+1)
+		}
+	}
+	assert.Equal(t, c.EstimateFrequency(elements[3]), c.Estimate(elements[3]))
+}
@@ -0,0 +1,134 @@
+package DBF
+
+import (
+	"bytes"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// deltaVersion is the version of the delta format written by DeltaFrom
+const deltaVersion = 2
+
+// DeltaFrom encodes the bits that are set in DBF but not in base, both must have the same m, k, seed and layout.
+// The delta is version (1 byte) | m (8 bytes) | k (8 bytes) | seed fingerprint (32 bytes) | flags (1 byte) |
+// domain length (4 bytes) | domain | seed hashes fingerprint (32 bytes) | index count (4 bytes) followed by the
+// ascending indices as uvarint gaps to the previous index, so it is small for few new bits. The flags and
+// domain are those of MarshalBinary, the seed hashes fingerprint tells whether the hash functions match.
+func (dbf *DistBF) DeltaFrom(base *DistBF) ([]byte, error) {
+	if err := dbf.checkCompatible(base); err != nil {
+		return nil, err
+	}
+	diff := dbf.b.Difference(base.b)
+	fp, hashesFp := dbf.SeedFingerprint(), dbf.seedHashesFingerprint()
+	var buf bytes.Buffer
+	buf.WriteByte(deltaVersion)
+	binary.Write(&buf, binary.BigEndian, uint64(dbf.m))
+	binary.Write(&buf, binary.BigEndian, uint64(dbf.k))
+	buf.Write(fp[:])
+	buf.WriteByte(dbf.layoutFlags())
+	binary.Write(&buf, binary.BigEndian, uint32(len(dbf.domain)))
+	buf.Write(dbf.domain)
+	buf.Write(hashesFp[:])
+	binary.Write(&buf, binary.BigEndian, uint32(diff.Count()))
+	varint := make([]byte, binary.MaxVarintLen64)
+	prev := uint(0)
+	for i, ok := diff.NextSet(0); ok; i, ok = diff.NextSet(i + 1) {
+		buf.Write(varint[:binary.PutUvarint(varint, uint64(i-prev))])
+		prev = i
+	}
+	return buf.Bytes(), nil
+}
+
+// ApplyDelta sets the bits of a delta produced by DeltaFrom, applying the same delta twice has no further effect
+func (dbf *DistBF) ApplyDelta(delta []byte) error {
+	if dbf.frozen {
+		return ErrFrozen
+	}
+	r := bytes.NewReader(delta)
+	var version uint8
+	if err := readField(r, &version); err != nil {
+		return err
+	}
+	if version != deltaVersion {
+		return fmt.Errorf("DBF: unsupported delta version %d, want %d", version, deltaVersion)
+	}
+	var m, k uint64
+	var fp [32]byte
+	var flags uint8
+	var domainLen uint32
+	for _, field := range []interface{}{&m, &k, &fp, &flags, &domainLen} {
+		if err := readField(r, field); err != nil {
+			return err
+		}
+	}
+	if int64(domainLen) > int64(r.Len()) {
+		return errors.New("DBF: truncated data")
+	}
+	domain := make([]byte, domainLen)
+	var hashesFp [32]byte
+	var count uint32
+	for _, field := range []interface{}{domain, &hashesFp, &count} {
+		if err := readField(r, field); err != nil {
+			return err
+		}
+	}
+	if m != uint64(dbf.m) || k != uint64(dbf.k) {
+		return fmt.Errorf("%w: delta for m=%d k=%d does not match m=%d k=%d", ErrIncompatibleParams, m, k, dbf.m, dbf.k)
+	}
+	if flags&^(flagPartitioned|flagLittleEndian) != 0 {
+		return fmt.Errorf("DBF: unknown layout flags %#x", flags)
+	}
+	layout := &DistBF{partitioned: flags&flagPartitioned != 0, littleEndian: flags&flagLittleEndian != 0}
+	if domainLen != 0 {
+		layout.domain = domain
+	}
+	if err := dbf.checkLayout(layout); err != nil {
+		return err
+	}
+	if fp != dbf.SeedFingerprint() {
+		return fmt.Errorf("%w: delta seed fingerprint differs", ErrSeedMismatch)
+	}
+	if hashesFp != dbf.seedHashesFingerprint() {
+		return fmt.Errorf("%w: delta seed hashes differ, the hash functions do not match", ErrIncompatibleParams)
+	}
+	// every index takes at least one byte
+	if int64(count) > int64(r.Len()) {
+		return errors.New("DBF: truncated data")
+	}
+	indices := make([]uint, 0, count)
+	prev := uint64(0)
+	for i := uint32(0); i < count; i++ {
+		gap, err := binary.ReadUvarint(r)
+		if err != nil {
+			return readError(err)
+		}
+		prev += gap
+		if prev >= m {
+			return fmt.Errorf("DBF: delta index %d out of range for m=%d", prev, m)
+		}
+		indices = append(indices, uint(prev))
+	}
+	if r.Len() != 0 {
+		return errors.New("DBF: trailing data after delta")
+	}
+	// set the bits only once the whole delta is valid
+	dbf.dropSummary()
+	for _, i := range indices {
+		dbf.b.Set(i)
+	}
+	return nil
+}
+
+// seedHashesFingerprint returns the SHA-512/256 of the seed hashes of DBF, which differs for DBFs whose hash
+// functions differ even with the same seed and domain
+func (dbf *DistBF) seedHashesFingerprint() [32]byte {
+	h := sha512.New512_256()
+	for _, seedHash := range dbf.hashes() {
+		h.Write(seedHash)
+	}
+	var fp [32]byte
+	h.Sum(fp[:0])
+	return fp
+}
@@ -0,0 +1,94 @@
+package DBF
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestDelta(t *testing.T) {
+	base := NewDbf(1000, 0.01, []byte("seed"))
+	for i := 0; i < 100; i++ {
+		base.Add([]byte(fmt.Sprintf("element-%d", i)))
+	}
+	dbf := base.Clone()
+	for i := 100; i < 110; i++ {
+		dbf.Add([]byte(fmt.Sprintf("element-%d", i)))
+	}
+	delta, err := dbf.DeltaFrom(base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := dbf.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(delta) >= len(data) {
+		t.Fatal("delta should be smaller than the encoded dbf")
+	}
+	for i := 0; i < 2; i++ {
+		if err := base.ApplyDelta(delta); err != nil {
+			t.Fatal(err)
+		}
+		if !base.Equals(dbf) {
+			t.Fatal("applying the delta should reproduce the dbf")
+		}
+	}
+	if _, err := dbf.DeltaFrom(NewDbf(1000, 0.01, []byte("other seed"))); err == nil {
+		t.Fatal("delta from a dbf with a different seed should fail")
+	}
+	if err := NewDbf(1000, 0.01, []byte("other seed")).ApplyDelta(delta); err == nil {
+		t.Fatal("applying a delta to a dbf with a different seed should fail")
+	}
+	if err := base.ApplyDelta(delta[:len(delta)-1]); err == nil {
+		t.Fatal("applying a truncated delta should fail")
+	}
+}
+
+func TestApplyDeltaMismatch(t *testing.T) {
+	base := NewDbf(1000, 0.01, []byte("seed"))
+	dbf := base.Clone()
+	dbf.Add([]byte("something"))
+	delta, err := dbf.DeltaFrom(base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := NewDbf(2000, 0.01, []byte("seed")).ApplyDelta(delta); !errors.Is(err, ErrIncompatibleParams) {
+		t.Fatalf("applying to a different m should fail with ErrIncompatibleParams, got %v", err)
+	}
+	if err := NewDbf(1000, 0.01, []byte("other seed")).ApplyDelta(delta); !errors.Is(err, ErrSeedMismatch) {
+		t.Fatalf("applying to a different seed should fail with ErrSeedMismatch, got %v", err)
+	}
+	if _, err := dbf.DeltaFrom(NewDbf(1000, 0.01, []byte("other seed"))); !errors.Is(err, ErrSeedMismatch) {
+		t.Fatalf("delta from a different seed should fail with ErrSeedMismatch, got %v", err)
+	}
+	receivers := []struct {
+		name string
+		opts []Option
+		want error
+	}{
+		{"partitioning", []Option{WithPartitioning()}, ErrIncompatibleParams},
+		{"byte order", []Option{WithLittleEndianIndices()}, ErrIncompatibleParams},
+		{"domain", []Option{WithDomain([]byte("domain"))}, ErrSeedMismatch},
+		{"hash", []Option{WithKeyedHash([]byte("key"))}, ErrIncompatibleParams},
+	}
+	for _, c := range receivers {
+		receiver := NewDbfWithOptions(1000, 0.01, append([]Option{WithSeed([]byte("seed"))}, c.opts...)...)
+		if err := receiver.ApplyDelta(delta); !errors.Is(err, c.want) {
+			t.Fatalf("applying to a dbf with another %s should fail with %v, got %v", c.name, c.want, err)
+		}
+		if receiver.Count() != 0 {
+			t.Fatalf("a rejected delta should leave the dbf with another %s unchanged", c.name)
+		}
+		// and the other way around, a delta of such a dbf does not apply to base
+		changed := receiver.Clone()
+		changed.Add([]byte("something"))
+		other, err := changed.DeltaFrom(receiver)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := base.ApplyDelta(other); !errors.Is(err, c.want) {
+			t.Fatalf("applying a delta of a dbf with another %s should fail with %v, got %v", c.name, c.want, err)
+		}
+	}
+}
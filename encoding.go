@@ -0,0 +1,628 @@
+package DBF
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+
+	"github.com/willf/bitset"
+)
+
+var (
+	_ encoding.BinaryMarshaler   = (*DistBF)(nil)
+	_ encoding.BinaryUnmarshaler = (*DistBF)(nil)
+	_ encoding.TextMarshaler     = (*DistBF)(nil)
+	_ encoding.TextUnmarshaler   = (*DistBF)(nil)
+	_ io.WriterTo                = (*DistBF)(nil)
+)
+
+// binaryVersion is the version of the binary format written by MarshalBinary, version 4 without the layout
+// and version 3 without n and fpr either are still read
+const binaryVersion = 5
+
+// layout flags of the binary format
+const (
+	flagPartitioned uint8 = 1 << iota
+	flagLittleEndian
+)
+
+// maxDecodedK bounds the k of decoded DBFs, so a corrupt k cannot make decoding compute billions of seed hashes.
+// EstimateParameters needs about 1000 hashes even for a false positive rate of 1e-300.
+const maxDecodedK = 1 << 16
+
+// readChunkWords is how many words of a dense bit array are read at a time, so a corrupt word count fails on
+// the truncated read instead of allocating the whole bit array upfront
+const readChunkWords = 1 << 16
+
+// ErrChecksumMismatch is returned when decoding a DBF whose checksum does not match its data
+var ErrChecksumMismatch = errors.New("DBF: checksum mismatch")
+
+// Encoding selects how MarshalBinaryEncoding writes the bit array in the binary format
+type Encoding uint8
+
+// encodings of the bit array in the binary format
+const (
+	// EncodingDense is the word count (4 bytes) followed by the words (8 bytes each)
+	EncodingDense Encoding = iota
+	// EncodingIndexList is the index count (4 bytes) followed by the ascending set bit indices,
+	// 4 bytes each if m <= 2^32 and 8 bytes otherwise
+	EncodingIndexList
+	// EncodingVarintDelta is the index count (4 bytes) followed by the ascending set bit indices as uvarint
+	// gaps to the previous index, the first one to 0, which is smallest for sparse or clustered bits
+	EncodingVarintDelta
+)
+
+// MarshalBinary encodes the DBF as
+// version (1 byte) | m (8 bytes) | k (8 bytes) | n (8 bytes) | fpr (8 bytes) | seed length (4 bytes) | seed |
+// flags (1 byte) | domain length (4 bytes) | domain | encoding (1 byte) | bit array | checksum (4 bytes)
+// where all integers are big endian, n and fpr are the DesignCapacity and the IEEE 754 TargetFPR, flags has
+// bit 0 set for WithPartitioning and bit 1 for WithLittleEndianIndices, the domain is that of WithDomain,
+// the bit array is dense and the checksum is the IEEE CRC-32 of all preceding bytes
+func (dbf *DistBF) MarshalBinary() ([]byte, error) {
+	return dbf.MarshalBinaryEncoding(EncodingDense)
+}
+
+// MarshalBinaryCompressed encodes the DBF like MarshalBinary, but in whichever encoding of the bit array is
+// smallest, an index list or varint deltas for sparse DBFs. UnmarshalBinary reads every encoding.
+func (dbf *DistBF) MarshalBinaryCompressed() ([]byte, error) {
+	best, bestSize := EncodingDense, uint64(len(dbf.b.Bytes()))*8
+	if size := uint64(dbf.Count()) * uint64(indexWidth(dbf.m)); size < bestSize {
+		best, bestSize = EncodingIndexList, size
+	}
+	if size := dbf.varintDeltaSize(); size < bestSize {
+		best = EncodingVarintDelta
+	}
+	return dbf.MarshalBinaryEncoding(best)
+}
+
+// MarshalBinaryEncoding encodes the DBF like MarshalBinary with the bit array in encoding enc
+func (dbf *DistBF) MarshalBinaryEncoding(enc Encoding) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := dbf.writeBinaryEncoding(&buf, enc); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBinary decodes a DBF encoded by MarshalBinary into dbf, returning ErrChecksumMismatch if the data
+// was corrupted. The layout options partitioning, domain and index byte order are encoded: a zero DistBF,
+// like those gob decodes into, takes them from the data, any other dbf must have the same ones or decoding
+// fails with ErrIncompatibleParams or ErrSeedMismatch. The hash function is not encoded, dbf keeps its own.
+// Data of version 4 or older does not record the layout, dbf keeps its own then.
+func (dbf *DistBF) UnmarshalBinary(data []byte) error {
+	if dbf.frozen {
+		return ErrFrozen
+	}
+	r := bytes.NewReader(data)
+	d, layout, err := readBinary(r)
+	if err != nil {
+		return err
+	}
+	if r.Len() != 0 {
+		return errors.New("DBF: trailing data after encoded filter")
+	}
+	return dbf.setState(d, layout)
+}
+
+// setState replaces the parameters, design capacity, target fpr and bits of dbf with those of the decoded d,
+// and its layout with that of d if layout is true and checkLayout allows it, keeping the other options of dbf
+func (dbf *DistBF) setState(d *DistBF, layout bool) error {
+	if layout {
+		if err := dbf.checkLayout(d); err != nil {
+			return err
+		}
+		dbf.partitioned = d.partitioned
+		dbf.littleEndian = d.littleEndian
+		dbf.domain = d.domain
+	}
+	dbf.n = d.n
+	dbf.fpr = d.fpr
+	dbf.m = d.m
+	dbf.k = d.k
+	dbf.s = d.s
+	dbf.b = d.b
+	dbf.dropSummary()
+	// the decoded bits were not set by the audited adds
+	dbf.resetAudit()
+	dbf.resetSeedHashes()
+	return nil
+}
+
+// checkLayout returns an error wrapping ErrIncompatibleParams or ErrSeedMismatch if the layout of the decoded
+// d differs from that of dbf, unless dbf is a zero DistBF without layout options, which takes any layout
+func (dbf *DistBF) checkLayout(d *DistBF) error {
+	if dbf.b == nil && !dbf.partitioned && !dbf.littleEndian && len(dbf.domain) == 0 {
+		return nil
+	}
+	if dbf.partitioned != d.partitioned {
+		return fmt.Errorf("%w: partitioning differs from the decoded filter", ErrIncompatibleParams)
+	}
+	if dbf.littleEndian != d.littleEndian {
+		return fmt.Errorf("%w: index byte order differs from the decoded filter", ErrIncompatibleParams)
+	}
+	if !bytes.Equal(dbf.domain, d.domain) {
+		return fmt.Errorf("%w: domain differs from the decoded filter", ErrSeedMismatch)
+	}
+	return nil
+}
+
+// MarshalText encodes the DBF as the unpadded URL safe base64 of MarshalBinaryCompressed, a single token
+// for URLs, environment variables or log lines
+func (dbf *DistBF) MarshalText() ([]byte, error) {
+	data, err := dbf.MarshalBinaryCompressed()
+	if err != nil {
+		return nil, err
+	}
+	text := make([]byte, base64.RawURLEncoding.EncodedLen(len(data)))
+	base64.RawURLEncoding.Encode(text, data)
+	return text, nil
+}
+
+// UnmarshalText decodes a DBF encoded by MarshalText into dbf like UnmarshalBinary
+func (dbf *DistBF) UnmarshalText(text []byte) error {
+	data := make([]byte, base64.RawURLEncoding.DecodedLen(len(text)))
+	n, err := base64.RawURLEncoding.Decode(data, text)
+	if err != nil {
+		return fmt.Errorf("DBF: invalid text encoding: %v", err)
+	}
+	return dbf.UnmarshalBinary(data[:n])
+}
+
+// WriteTo writes the DBF to w in the format of MarshalBinary and returns the number of bytes written
+func (dbf *DistBF) WriteTo(w io.Writer) (int64, error) {
+	cw := &countingWriter{w: w}
+	err := dbf.writeBinary(cw)
+	return cw.n, err
+}
+
+// ReadDbf reads a DBF written by WriteTo or MarshalBinary from r, without reading past its end. The DBF
+// takes its layout from the data, opts set the options that are not encoded like WithHash, any layout
+// options among them must match the data like for UnmarshalBinary.
+func ReadDbf(r io.Reader, opts ...Option) (*DistBF, error) {
+	d, layout, err := readBinary(r)
+	if err != nil {
+		return nil, err
+	}
+	dbf := &DistBF{}
+	for _, opt := range opts {
+		opt(dbf)
+	}
+	if err := dbf.setState(d, layout); err != nil {
+		return nil, err
+	}
+	return dbf, nil
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
+
+func (dbf *DistBF) writeBinary(w io.Writer) error {
+	return dbf.writeBinaryEncoding(w, EncodingDense)
+}
+
+// Checksum returns the checksum that MarshalBinary writes for DBF, to store along with the data
+func (dbf *DistBF) Checksum() uint32 {
+	crc := crc32.NewIEEE()
+	// writing to a hash never fails
+	_ = dbf.writeFields(crc, EncodingDense)
+	return crc.Sum32()
+}
+
+// writeBinaryEncoding writes the fields of DBF followed by their checksum
+func (dbf *DistBF) writeBinaryEncoding(w io.Writer, enc Encoding) error {
+	crc := crc32.NewIEEE()
+	if err := dbf.writeFields(io.MultiWriter(w, crc), enc); err != nil {
+		return err
+	}
+	return binary.Write(w, binary.BigEndian, crc.Sum32())
+}
+
+// writeFields writes DBF with the bit array in encoding enc, without the checksum
+func (dbf *DistBF) writeFields(w io.Writer, enc Encoding) error {
+	fields := []interface{}{
+		uint8(binaryVersion),
+		uint64(dbf.m),
+		uint64(dbf.k),
+		uint64(dbf.n),
+		math.Float64bits(dbf.fpr),
+		uint32(len(dbf.s)),
+		dbf.s,
+		dbf.layoutFlags(),
+		uint32(len(dbf.domain)),
+		dbf.domain,
+		uint8(enc),
+	}
+	switch enc {
+	case EncodingDense:
+		words := dbf.b.Bytes()
+		fields = append(fields, uint32(len(words)), words)
+	case EncodingIndexList:
+		indices := dbf.GetBitIndices()
+		fields = append(fields, uint32(len(indices)))
+		if indexWidth(dbf.m) == 4 {
+			list := make([]uint32, len(indices))
+			for i, index := range indices {
+				list[i] = uint32(index)
+			}
+			fields = append(fields, list)
+		} else {
+			list := make([]uint64, len(indices))
+			for i, index := range indices {
+				list[i] = uint64(index)
+			}
+			fields = append(fields, list)
+		}
+	case EncodingVarintDelta:
+		var gaps []byte
+		varint := make([]byte, binary.MaxVarintLen64)
+		prev := uint(0)
+		dbf.ForEachSetBit(func(index uint) bool {
+			gaps = append(gaps, varint[:binary.PutUvarint(varint, uint64(index-prev))]...)
+			prev = index
+			return true
+		})
+		fields = append(fields, uint32(dbf.Count()), gaps)
+	default:
+		return fmt.Errorf("DBF: unknown bit array encoding %d", enc)
+	}
+	for _, field := range fields {
+		if err := binary.Write(w, binary.BigEndian, field); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// layoutFlags returns the flags byte of the binary format for the layout options of DBF
+func (dbf *DistBF) layoutFlags() uint8 {
+	var flags uint8
+	if dbf.partitioned {
+		flags |= flagPartitioned
+	}
+	if dbf.littleEndian {
+		flags |= flagLittleEndian
+	}
+	return flags
+}
+
+// varintDeltaSize returns the bytes of the uvarint gaps of the varint delta encoding
+func (dbf *DistBF) varintDeltaSize() uint64 {
+	var size uint64
+	varint := make([]byte, binary.MaxVarintLen64)
+	prev := uint(0)
+	dbf.ForEachSetBit(func(index uint) bool {
+		size += uint64(binary.PutUvarint(varint, uint64(index-prev)))
+		prev = index
+		return true
+	})
+	return size
+}
+
+// indexWidth returns the bytes per index of the index list encoding for m bits
+func indexWidth(m uint) int {
+	if uint64(m) <= 1<<32 {
+		return 4
+	}
+	return 8
+}
+
+// readBinary reads the m, k, n, fpr, seed, layout and bits of a DBF in the format written by writeBinary and
+// verifies the checksum. layout is false for version 4 and older data, which leaves the layout options unset,
+// version 3 data leaves n and fpr 0 too.
+func readBinary(src io.Reader) (*DistBF, bool, error) {
+	crc := crc32.NewIEEE()
+	r := io.TeeReader(src, crc)
+	var version uint8
+	if err := readField(r, &version); err != nil {
+		return nil, false, err
+	}
+	if version < 3 || version > binaryVersion {
+		return nil, false, fmt.Errorf("DBF: unsupported binary version %d, want %d", version, binaryVersion)
+	}
+	var m, k uint64
+	if err := readField(r, &m); err != nil {
+		return nil, false, err
+	}
+	if err := readField(r, &k); err != nil {
+		return nil, false, err
+	}
+	if m == 0 || k == 0 {
+		return nil, false, errors.New("DBF: m and k must be greater than 0")
+	}
+	if m > uint64(^uint(0)) || k > uint64(^uint(0)) {
+		return nil, false, errors.New("DBF: m or k overflows uint")
+	}
+	if k > maxDecodedK {
+		return nil, false, fmt.Errorf("DBF: k=%d exceeds the maximum of %d", k, maxDecodedK)
+	}
+	var n, fprBits uint64
+	if version >= 4 {
+		if err := readField(r, &n); err != nil {
+			return nil, false, err
+		}
+		if err := readField(r, &fprBits); err != nil {
+			return nil, false, err
+		}
+	}
+	if n > uint64(^uint(0)) {
+		return nil, false, errors.New("DBF: n overflows uint")
+	}
+	fpr := math.Float64frombits(fprBits)
+	if !(fpr >= 0 && fpr < 1) {
+		return nil, false, fmt.Errorf("DBF: target fpr %v must be in [0, 1)", fpr)
+	}
+	var seedLen uint32
+	if err := readField(r, &seedLen); err != nil {
+		return nil, false, err
+	}
+	// copy the seed instead of allocating seedLen upfront, so a corrupt length fails on the truncated read
+	var seed bytes.Buffer
+	if _, err := io.CopyN(&seed, r, int64(seedLen)); err != nil {
+		return nil, false, readError(err)
+	}
+	layout := version >= 5
+	var flags uint8
+	var domain bytes.Buffer
+	if layout {
+		if err := readField(r, &flags); err != nil {
+			return nil, false, err
+		}
+		if flags&^(flagPartitioned|flagLittleEndian) != 0 {
+			return nil, false, fmt.Errorf("DBF: unknown layout flags %#x", flags)
+		}
+		if flags&flagPartitioned != 0 && m < k {
+			return nil, false, errors.New("DBF: a partitioned filter needs m of at least k")
+		}
+		var domainLen uint32
+		if err := readField(r, &domainLen); err != nil {
+			return nil, false, err
+		}
+		if _, err := io.CopyN(&domain, r, int64(domainLen)); err != nil {
+			return nil, false, readError(err)
+		}
+	}
+	var enc Encoding
+	if err := readField(r, (*uint8)(&enc)); err != nil {
+		return nil, false, err
+	}
+	var count uint32
+	if err := readField(r, &count); err != nil {
+		return nil, false, err
+	}
+	var b *bitset.BitSet
+	var err error
+	switch enc {
+	case EncodingDense:
+		if uint64(count) != (m+63)/64 {
+			return nil, false, fmt.Errorf("DBF: got %d words, want %d for m=%d", count, (m+63)/64, m)
+		}
+		if lr, ok := src.(interface{ Len() int }); ok && uint64(count)*8 > uint64(lr.Len()) {
+			return nil, false, errors.New("DBF: truncated data")
+		}
+		words, err := readWords(r, count)
+		if err != nil {
+			return nil, false, err
+		}
+		if m%64 != 0 && words[len(words)-1]>>(m%64) != 0 {
+			return nil, false, fmt.Errorf("DBF: bits set beyond m=%d", m)
+		}
+		if b, err = newBitSet(m); err != nil {
+			return nil, false, err
+		}
+		copy(b.Bytes(), words)
+	case EncodingIndexList:
+		if uint64(count) > m {
+			return nil, false, fmt.Errorf("DBF: got %d indices for m=%d", count, m)
+		}
+		if b, err = newBitSet(m); err != nil {
+			return nil, false, err
+		}
+		for i := uint32(0); i < count; i++ {
+			var index uint64
+			if indexWidth(uint(m)) == 4 {
+				var index32 uint32
+				if err := readField(r, &index32); err != nil {
+					return nil, false, err
+				}
+				index = uint64(index32)
+			} else if err := readField(r, &index); err != nil {
+				return nil, false, err
+			}
+			if index >= m {
+				return nil, false, fmt.Errorf("DBF: index %d out of range for m=%d", index, m)
+			}
+			b.Set(uint(index))
+		}
+	case EncodingVarintDelta:
+		if uint64(count) > m {
+			return nil, false, fmt.Errorf("DBF: got %d indices for m=%d", count, m)
+		}
+		if b, err = newBitSet(m); err != nil {
+			return nil, false, err
+		}
+		br := byteReader{r}
+		index := uint64(0)
+		for i := uint32(0); i < count; i++ {
+			gap, err := binary.ReadUvarint(br)
+			if err != nil {
+				return nil, false, readError(err)
+			}
+			if gap >= m-index || (i > 0 && gap == 0) {
+				return nil, false, fmt.Errorf("DBF: index gap %d out of range after %d for m=%d", gap, index, m)
+			}
+			index += gap
+			b.Set(uint(index))
+		}
+	default:
+		return nil, false, fmt.Errorf("DBF: unknown bit array encoding %d", enc)
+	}
+	var checksum uint32
+	if err := readField(src, &checksum); err != nil {
+		return nil, false, err
+	}
+	if checksum != crc.Sum32() {
+		return nil, false, ErrChecksumMismatch
+	}
+	d := &DistBF{m: uint(m), k: uint(k), n: uint(n), fpr: fpr, s: seed.Bytes(), b: b}
+	d.partitioned = flags&flagPartitioned != 0
+	d.littleEndian = flags&flagLittleEndian != 0
+	if domain.Len() != 0 {
+		d.domain = domain.Bytes()
+	}
+	return d, layout, nil
+}
+
+// newBitSet returns the empty bit array of m bits, or an error if m is too large for one, which
+// bitset.New reports by returning an empty bit array
+func newBitSet(m uint64) (*bitset.BitSet, error) {
+	b := bitset.New(uint(m))
+	if uint64(b.Len()) != m {
+		return nil, fmt.Errorf("DBF: m=%d is too large for a bit array", m)
+	}
+	return b, nil
+}
+
+// readWords reads count big endian words in chunks of readChunkWords, so memory grows with the data read
+func readWords(r io.Reader, count uint32) ([]uint64, error) {
+	var words []uint64
+	for remaining := int(count); remaining > 0; {
+		n := remaining
+		if n > readChunkWords {
+			n = readChunkWords
+		}
+		chunk := make([]uint64, n)
+		if err := readField(r, chunk); err != nil {
+			return nil, err
+		}
+		words = append(words, chunk...)
+		remaining -= len(chunk)
+	}
+	return words, nil
+}
+
+// byteReader reads single bytes from a reader for binary.ReadUvarint
+type byteReader struct {
+	io.Reader
+}
+
+func (br byteReader) ReadByte() (byte, error) {
+	var b [1]byte
+	_, err := io.ReadFull(br.Reader, b[:])
+	return b[0], err
+}
+
+// readField reads a single big endian field, reporting a short read as truncated data
+func readField(r io.Reader, data interface{}) error {
+	return readError(binary.Read(r, binary.BigEndian, data))
+}
+
+func readError(err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return errors.New("DBF: truncated data")
+	}
+	return err
+}
+
+// jsonDistBF is the JSON form of a DBF, Seed and Bits are encoded as standard base64 strings.
+// Bits holds ceil(m/8) bytes where bit i of the DBF is bit i%8 (least significant first) of byte i/8.
+type jsonDistBF struct {
+	M            uint    `json:"m"`
+	K            uint    `json:"k"`
+	N            uint    `json:"n,omitempty"`
+	FPR          float64 `json:"fpr,omitempty"`
+	Seed         []byte  `json:"seed"`
+	Partitioned  bool    `json:"partitioned,omitempty"`
+	Domain       []byte  `json:"domain,omitempty"`
+	LittleEndian bool    `json:"little_endian,omitempty"`
+	Bits         []byte  `json:"bits"`
+}
+
+// MarshalJSON encodes the DBF as {"m": m, "k": k, "n": n, "fpr": fpr, "seed": base64, "bits": base64},
+// n and fpr are the DesignCapacity and TargetFPR and omitted when unknown. The layout options are encoded as
+// "partitioned": true, "domain": base64 and "little_endian": true when set.
+func (dbf *DistBF) MarshalJSON() ([]byte, error) {
+	return json.Marshal(jsonDistBF{
+		M:            dbf.m,
+		K:            dbf.k,
+		N:            dbf.n,
+		FPR:          dbf.fpr,
+		Seed:         dbf.s,
+		Partitioned:  dbf.partitioned,
+		Domain:       dbf.domain,
+		LittleEndian: dbf.littleEndian,
+		Bits:         bitSetToBytes(dbf.b, dbf.m),
+	})
+}
+
+// UnmarshalJSON decodes a DBF encoded by MarshalJSON into dbf, taking or checking the layout like
+// UnmarshalBinary
+func (dbf *DistBF) UnmarshalJSON(data []byte) error {
+	if dbf.frozen {
+		return ErrFrozen
+	}
+	var j jsonDistBF
+	if err := json.Unmarshal(data, &j); err != nil {
+		return err
+	}
+	if j.M == 0 || j.K == 0 {
+		return errors.New("DBF: m and k must be greater than 0")
+	}
+	if j.K > maxDecodedK {
+		return fmt.Errorf("DBF: k=%d exceeds the maximum of %d", j.K, maxDecodedK)
+	}
+	if !(j.FPR >= 0 && j.FPR < 1) {
+		return fmt.Errorf("DBF: target fpr %v must be in [0, 1)", j.FPR)
+	}
+	if j.Partitioned && j.M < j.K {
+		return errors.New("DBF: a partitioned filter needs m of at least k")
+	}
+	b, err := bitSetFromBytes(j.Bits, j.M)
+	if err != nil {
+		return err
+	}
+	d := &DistBF{m: j.M, k: j.K, n: j.N, fpr: j.FPR, s: j.Seed, b: b}
+	d.partitioned, d.domain, d.littleEndian = j.Partitioned, j.Domain, j.LittleEndian
+	return dbf.setState(d, true)
+}
+
+// bitSetToBytes packs the first m bits of b into ceil(m/8) bytes, least significant bit first
+func bitSetToBytes(b *bitset.BitSet, m uint) []byte {
+	ret := make([]byte, (m+7)/8)
+	for i, word := range b.Bytes() {
+		for j := 0; j < 8 && i*8+j < len(ret); j++ {
+			ret[i*8+j] = byte(word >> (8 * uint(j)))
+		}
+	}
+	return ret
+}
+
+// bitSetFromBytes unpacks bytes written by bitSetToBytes into a bit set of length m
+func bitSetFromBytes(data []byte, m uint) (*bitset.BitSet, error) {
+	if uint(len(data)) != (m+7)/8 {
+		return nil, fmt.Errorf("DBF: got %d bytes of bits, want %d for m=%d", len(data), (m+7)/8, m)
+	}
+	if m%8 != 0 && data[len(data)-1]>>(m%8) != 0 {
+		return nil, fmt.Errorf("DBF: bits set beyond m=%d", m)
+	}
+	b := bitset.New(m)
+	words := b.Bytes()
+	for i, v := range data {
+		words[i/8] |= uint64(v) << (8 * uint(i%8))
+	}
+	return b, nil
+}
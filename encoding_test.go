@@ -0,0 +1,555 @@
+package DBF
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMarshalBinary(t *testing.T) {
+	dbf := NewDbf(100, 0.1, []byte("seed"))
+	element := []byte("something")
+	dbf.Add(element)
+	data, err := dbf.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded DistBF
+	if err := decoded.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.m != dbf.m || decoded.k != dbf.k || string(decoded.s) != string(dbf.s) {
+		t.Fatal("decoded parameters differ from the original dbf")
+	}
+	if !decoded.Contains(element) {
+		t.Fatal("decoded dbf should contain the added element")
+	}
+	if decoded.Contains([]byte("something else")) {
+		t.Fatal("decoded dbf should not contain an element that was not added")
+	}
+}
+
+func TestUnmarshalBinaryInvalid(t *testing.T) {
+	dbf := NewDbf(100, 0.1, []byte("seed"))
+	data, err := dbf.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded DistBF
+	for i := 0; i < len(data); i++ {
+		if err := decoded.UnmarshalBinary(data[:i]); err == nil {
+			t.Fatalf("truncated data of length %d should fail", i)
+		}
+	}
+	wrongVersion := append([]byte(nil), data...)
+	wrongVersion[0] = binaryVersion + 1
+	if err := decoded.UnmarshalBinary(wrongVersion); err == nil {
+		t.Fatal("data with a different version should fail")
+	}
+	if err := decoded.UnmarshalBinary(append(data, 0)); err == nil {
+		t.Fatal("data with trailing bytes should fail")
+	}
+}
+
+func TestUnmarshalBinaryChecksum(t *testing.T) {
+	dbf := NewDbf(100, 0.1, []byte("seed"))
+	dbf.Add([]byte("something"))
+	data, err := dbf.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, binary.BigEndian.Uint32(data[len(data)-4:]), dbf.Checksum())
+	// flip a byte of the seed, a bit array word and the checksum itself
+	seedStart := 1 + 8 + 8 + 8 + 8 + 4
+	for _, i := range []int{seedStart, len(data) - 5, len(data) - 1} {
+		corrupted := append([]byte(nil), data...)
+		corrupted[i] ^= 0x01
+		var decoded DistBF
+		if err := decoded.UnmarshalBinary(corrupted); err != ErrChecksumMismatch {
+			t.Fatalf("flipping byte %d should fail with ErrChecksumMismatch, got %v", i, err)
+		}
+		if _, err := ReadDbf(bytes.NewReader(corrupted)); err != ErrChecksumMismatch {
+			t.Fatalf("reading with byte %d flipped should fail with ErrChecksumMismatch, got %v", i, err)
+		}
+	}
+	other := NewDbf(100, 0.1, []byte("seed"))
+	if other.Checksum() == dbf.Checksum() {
+		t.Fatal("DBFs with different bits should have different checksums")
+	}
+}
+
+func TestGob(t *testing.T) {
+	gob.Register(&DistBF{})
+	elements := [][]byte{[]byte("something"), []byte("something else")}
+	var filters []DistBF
+	for _, elem := range elements {
+		dbf := NewDbf(100, 0.1, []byte("seed"))
+		dbf.Add(elem)
+		filters = append(filters, *dbf)
+	}
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(filters); err != nil {
+		t.Fatal(err)
+	}
+	var decoded []DistBF
+	if err := gob.NewDecoder(&buf).Decode(&decoded); err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded) != len(filters) {
+		t.Fatal("all dbfs should be decoded")
+	}
+	for i := range filters {
+		for _, elem := range elements {
+			if decoded[i].Contains(elem) != filters[i].Contains(elem) {
+				t.Fatal("decoded dbf should answer Contains like the original dbf")
+			}
+		}
+	}
+}
+
+func TestMarshalJSON(t *testing.T) {
+	dbf := NewDbf(100, 0.1, []byte("seed"))
+	element := []byte("something")
+	dbf.Add(element)
+	data, err := json.Marshal(dbf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"m", "k", "seed", "bits"} {
+		if _, ok := fields[name]; !ok {
+			t.Fatalf("json field %s is missing", name)
+		}
+	}
+	if fields["seed"] != base64.StdEncoding.EncodeToString([]byte("seed")) {
+		t.Fatal("seed should be encoded as base64")
+	}
+	var decoded DistBF
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !decoded.Contains(element) {
+		t.Fatal("decoded dbf should contain the added element")
+	}
+	assert.Equal(t, dbf.GetBitIndices(), decoded.GetBitIndices())
+}
+
+func TestUnmarshalJSONInvalid(t *testing.T) {
+	var decoded DistBF
+	tests := []string{
+		`{"m": 16, "k": 2, "seed": "c2VlZA==", "bits": "AA=="}`,
+		`{"m": 4, "k": 2, "seed": "c2VlZA==", "bits": "EA=="}`,
+		`{"m": 0, "k": 2, "seed": "c2VlZA==", "bits": ""}`,
+		`{"m": 8, "k": 2, "n": 1, "fpr": 1.5, "seed": "c2VlZA==", "bits": "AA=="}`,
+	}
+	for _, tt := range tests {
+		if err := json.Unmarshal([]byte(tt), &decoded); err == nil {
+			t.Fatalf("%s should fail to decode", tt)
+		}
+	}
+}
+
+func TestMarshalText(t *testing.T) {
+	dbf := NewDbf(100, 0.1, []byte("seed"))
+	dbf.Add([]byte("something"))
+	text, err := dbf.MarshalText()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.ContainsAny(text, "+/=\n") {
+		t.Fatalf("text %q should be a single URL safe token", text)
+	}
+	var decoded DistBF
+	if err := decoded.UnmarshalText(text); err != nil {
+		t.Fatal(err)
+	}
+	if !decoded.Equals(dbf) {
+		t.Fatal("decoded dbf should equal the original dbf")
+	}
+	for _, invalid := range []string{"not base64!", "", string(text[:len(text)-2]), "A" + string(text)} {
+		if err := decoded.UnmarshalText([]byte(invalid)); err == nil {
+			t.Fatalf("decoding %q should fail", invalid)
+		}
+	}
+}
+
+func TestUnmarshalBinaryLayout(t *testing.T) {
+	layouts := map[string][]Option{
+		"partitioned":   {WithPartitioning()},
+		"domain":        {WithDomain([]byte("domain"))},
+		"little endian": {WithLittleEndianIndices()},
+		"all":           {WithPartitioning(), WithDomain([]byte("domain")), WithLittleEndianIndices()},
+	}
+	elements := batchElements(100)
+	for name, opts := range layouts {
+		dbf := NewDbfWithOptions(100, 0.01, append([]Option{WithSeed([]byte("seed"))}, opts...)...)
+		dbf.AddBatch(elements)
+		data, err := dbf.MarshalBinaryCompressed()
+		if err != nil {
+			t.Fatal(err)
+		}
+		jsonData, err := json.Marshal(dbf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		if _, err := dbf.WriteTo(&buf); err != nil {
+			t.Fatal(err)
+		}
+		read, err := ReadDbf(&buf, WithLazySeedHashes())
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		var binaryDecoded, jsonDecoded DistBF
+		if err := binaryDecoded.UnmarshalBinary(data); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if err := json.Unmarshal(jsonData, &jsonDecoded); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		same := NewDbfWithOptions(1, 0.5, opts...)
+		if err := same.UnmarshalBinary(data); err != nil {
+			t.Fatalf("%s: decoding into a dbf with the same layout: %v", name, err)
+		}
+		for _, decoded := range []*DistBF{read, &binaryDecoded, &jsonDecoded, same} {
+			if !decoded.Compatible(dbf) || !decoded.Equals(dbf) {
+				t.Fatalf("%s: a decoded dbf should take the layout of the data", name)
+			}
+			for _, elem := range elements {
+				if !decoded.Contains(elem) {
+					t.Fatalf("%s: a decoded dbf should contain the added elements", name)
+				}
+			}
+		}
+
+		plain := NewDbfWithParams(10, 1, []byte("seed"))
+		if err := plain.UnmarshalBinary(data); err == nil {
+			t.Fatalf("%s: decoding into a dbf with another layout should fail", name)
+		}
+		if err := json.Unmarshal(jsonData, plain); err == nil {
+			t.Fatalf("%s: decoding json into a dbf with another layout should fail", name)
+		}
+		if plain.m != 10 {
+			t.Fatalf("%s: a failed decoding should leave the dbf unchanged", name)
+		}
+	}
+	data, err := NewDbf(100, 0.01, []byte("seed")).MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadDbf(bytes.NewReader(data), WithPartitioning()); !errors.Is(err, ErrIncompatibleParams) {
+		t.Fatalf("reading with another partitioning should fail with ErrIncompatibleParams, got %v", err)
+	}
+	if _, err := ReadDbf(bytes.NewReader(data), WithDomain([]byte("domain"))); !errors.Is(err, ErrSeedMismatch) {
+		t.Fatalf("reading with another domain should fail with ErrSeedMismatch, got %v", err)
+	}
+}
+
+func TestWriteToReadDbf(t *testing.T) {
+	dbf := NewDbf(100, 0.1, []byte("seed"))
+	dbf.Add([]byte("something"))
+	f, err := ioutil.TempFile("", "dbf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	n, err := dbf.WriteTo(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != info.Size() {
+		t.Fatalf("WriteTo reported %d bytes, wrote %d", n, info.Size())
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := ReadDbf(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !decoded.Equals(dbf) {
+		t.Fatal("read dbf should equal the written dbf")
+	}
+	data, err := dbf.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadDbf(bytes.NewReader(data[:len(data)-3])); err == nil {
+		t.Fatal("reading a truncated dbf should fail")
+	}
+}
+
+func TestMarshalBinaryCompressed(t *testing.T) {
+	dbf := NewDbf(10000, 0.01, []byte("seed"))
+	for i := 0; i < 10; i++ {
+		dbf.Add([]byte(randStringBytes(8)))
+	}
+	dense, err := dbf.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	compressed, err := dbf.MarshalBinaryCompressed()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(compressed)*10 > len(dense) {
+		t.Fatalf("compressed sparse dbf takes %d bytes, dense takes %d", len(compressed), len(dense))
+	}
+	var decoded DistBF
+	if err := decoded.UnmarshalBinary(compressed); err != nil {
+		t.Fatal(err)
+	}
+	if !decoded.Equals(dbf) {
+		t.Fatal("decoded compressed dbf should equal the original dbf")
+	}
+	for i := 0; i < len(compressed); i++ {
+		if err := decoded.UnmarshalBinary(compressed[:i]); err == nil {
+			t.Fatalf("truncated data of length %d should fail", i)
+		}
+	}
+	// a full dbf falls back to the dense encoding
+	for i := uint(0); i < dbf.m; i++ {
+		dbf.b.Set(i)
+	}
+	compressed, err = dbf.MarshalBinaryCompressed()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dense, err = dbf.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, dense, compressed)
+}
+
+func TestMarshalBinaryEncoding(t *testing.T) {
+	for _, n := range []int{0, 10, 100, 1000, 5000} {
+		dbf := NewDbf(1000, 0.01, []byte("seed"))
+		dbf.AddBatch(batchElements(n))
+		sizes := make(map[Encoding]int)
+		for _, enc := range []Encoding{EncodingDense, EncodingIndexList, EncodingVarintDelta} {
+			data, err := dbf.MarshalBinaryEncoding(enc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var decoded DistBF
+			if err := decoded.UnmarshalBinary(data); err != nil {
+				t.Fatal(err)
+			}
+			if !decoded.Equals(dbf) {
+				t.Fatalf("encoding %d of %d elements should decode to an equal dbf", enc, n)
+			}
+			for i := 0; i < len(data); i += 1 + len(data)/100 {
+				if err := decoded.UnmarshalBinary(data[:i]); err == nil {
+					t.Fatalf("truncated encoding %d of length %d should fail", enc, i)
+				}
+			}
+			sizes[enc] = len(data)
+		}
+		// a gap is at most as wide as an index of m <= 2^32
+		if sizes[EncodingVarintDelta] > sizes[EncodingIndexList] {
+			t.Fatalf("%d elements: varint deltas take %d bytes, the index list %d",
+				n, sizes[EncodingVarintDelta], sizes[EncodingIndexList])
+		}
+		compressed, err := dbf.MarshalBinaryCompressed()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for enc, size := range sizes {
+			if len(compressed) > size {
+				t.Fatalf("%d elements: compressed takes %d bytes, encoding %d %d", n, len(compressed), enc, size)
+			}
+		}
+		t.Logf("%d elements at fill ratio %.2f: dense %d, index list %d, varint delta %d bytes", n,
+			dbf.FillRatio(), sizes[EncodingDense], sizes[EncodingIndexList], sizes[EncodingVarintDelta])
+	}
+	if _, err := NewDbf(10, 0.1, []byte("seed")).MarshalBinaryEncoding(Encoding(9)); err == nil {
+		t.Fatal("an unknown encoding should fail")
+	}
+}
+
+func TestUnmarshalBinaryVarintDeltaInvalid(t *testing.T) {
+	dbf := NewDbfWithParams(64, 1, []byte("seed"))
+	encode := func(count uint32, gaps ...byte) []byte {
+		var buf bytes.Buffer
+		dbf.writeFields(&buf, EncodingDense)
+		data := buf.Bytes()
+		// replace the dense bit array after the encoding byte
+		header := 1 + 8 + 8 + 8 + 8 + 4 + len(dbf.s) + 1 + 4
+		data = append(data[:header:header], byte(EncodingVarintDelta))
+		data = append(data, byte(count>>24), byte(count>>16), byte(count>>8), byte(count))
+		data = append(data, gaps...)
+		sum := make([]byte, 4)
+		binary.BigEndian.PutUint32(sum, crc32.ChecksumIEEE(data))
+		return append(data, sum...)
+	}
+	var decoded DistBF
+	if err := decoded.UnmarshalBinary(encode(2, 3, 60)); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []uint{3, 63}, decoded.GetBitIndices())
+	for name, data := range map[string][]byte{
+		"index beyond m":   encode(2, 3, 61),
+		"repeated index":   encode(2, 3, 0),
+		"count beyond m":   encode(65),
+		"truncated varint": encode(1, 0x80),
+	} {
+		if err := decoded.UnmarshalBinary(data); err == nil {
+			t.Fatalf("%s should fail", name)
+		}
+	}
+}
+
+func TestDesignIntentRoundTrip(t *testing.T) {
+	dbf := NewDbf(1000, 0.01, []byte("seed"))
+	dbf.Add([]byte("something"))
+	assert.Equal(t, uint(1000), dbf.DesignCapacity())
+	assert.Equal(t, 0.01, dbf.TargetFPR())
+	binaryData, err := dbf.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	compressed, err := dbf.MarshalBinaryCompressed()
+	if err != nil {
+		t.Fatal(err)
+	}
+	text, err := dbf.MarshalText()
+	if err != nil {
+		t.Fatal(err)
+	}
+	jsonData, err := json.Marshal(dbf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoders := map[string]func(d *DistBF) error{
+		"binary":     func(d *DistBF) error { return d.UnmarshalBinary(binaryData) },
+		"compressed": func(d *DistBF) error { return d.UnmarshalBinary(compressed) },
+		"text":       func(d *DistBF) error { return d.UnmarshalText(text) },
+		"json":       func(d *DistBF) error { return json.Unmarshal(jsonData, d) },
+	}
+	for name, decode := range decoders {
+		decoded := NewDbfWithParams(10, 1, []byte("other"))
+		if err := decode(decoded); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if decoded.DesignCapacity() != 1000 || decoded.TargetFPR() != 0.01 {
+			t.Fatalf("%s: decoded n=%d fpr=%v, want 1000 and 0.01", name, decoded.DesignCapacity(), decoded.TargetFPR())
+		}
+		assert.Equal(t, dbf.OptimalK(), decoded.OptimalK())
+	}
+	read, err := ReadDbf(bytes.NewReader(binaryData))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, uint(1000), read.DesignCapacity())
+	assert.Equal(t, 0.01, read.TargetFPR())
+
+	unknown, err := NewDbfWithParams(64, 2, []byte("seed")).MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded DistBF
+	if err := decoded.UnmarshalBinary(unknown); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.DesignCapacity() != 0 || decoded.TargetFPR() != 0 {
+		t.Fatal("an unknown design capacity and target fpr should stay unknown")
+	}
+}
+
+func TestUnmarshalBinaryOldVersions(t *testing.T) {
+	dbf := NewDbfWithOptions(100, 0.1, WithSeed([]byte("seed")), WithPartitioning())
+	dbf.Add([]byte("something"))
+	var buf bytes.Buffer
+	if err := dbf.writeFields(&buf, EncodingDense); err != nil {
+		t.Fatal(err)
+	}
+	fields := buf.Bytes()
+	seedEnd := 1 + 8 + 8 + 8 + 8 + 4 + len(dbf.s)
+	// version 4 has no flags and domain after the seed
+	v4 := append([]byte{4}, fields[1:seedEnd]...)
+	v4 = append(v4, fields[seedEnd+1+4:]...)
+	// version 3 has no n and fpr after m and k either
+	v3 := append([]byte{3}, v4[1:17]...)
+	v3 = append(v3, v4[33:]...)
+	for version, data := range map[int][]byte{3: v3, 4: v4} {
+		data = append(data, 0, 0, 0, 0)
+		binary.BigEndian.PutUint32(data[len(data)-4:], crc32.ChecksumIEEE(data[:len(data)-4]))
+		decoded := NewDbfWithOptions(1, 0.5, WithPartitioning())
+		if err := decoded.UnmarshalBinary(data); err != nil {
+			t.Fatalf("version %d: %v", version, err)
+		}
+		if !decoded.Equals(dbf) || !decoded.Contains([]byte("something")) {
+			t.Fatalf("version %d data should decode keeping the layout of the receiver", version)
+		}
+		if version == 3 && (decoded.DesignCapacity() != 0 || decoded.TargetFPR() != 0) {
+			t.Fatal("version 3 data should decode with an unknown design capacity and target fpr")
+		}
+	}
+}
+
+// encodeFields writes fields big endian followed by their checksum, for crafting corrupt encodings
+func encodeFields(fields ...interface{}) []byte {
+	var buf bytes.Buffer
+	for _, field := range fields {
+		binary.Write(&buf, binary.BigEndian, field)
+	}
+	binary.Write(&buf, binary.BigEndian, crc32.ChecksumIEEE(buf.Bytes()))
+	return buf.Bytes()
+}
+
+func TestUnmarshalBinaryCorruptHeader(t *testing.T) {
+	seed := []byte("seed")
+	header := func(m, k uint64) []interface{} {
+		return []interface{}{uint8(binaryVersion), m, k, uint64(0), uint64(0), uint32(len(seed)), seed, uint8(0), uint32(0)}
+	}
+	tests := map[string][]byte{
+		// claims 16 GiB of words that are not there
+		"huge word count": encodeFields(append(header(1<<37, 1), uint8(EncodingDense), uint32(1<<31))...),
+		"bits beyond m":   encodeFields(append(header(10, 1), uint8(EncodingDense), uint32(1), ^uint64(0))...),
+		// too large for a bit array, which bitset.New reports with an empty one
+		"huge m index list":   encodeFields(append(header(1<<62, 1), uint8(EncodingIndexList), uint32(0))...),
+		"huge m varint delta": encodeFields(append(header(1<<62, 1), uint8(EncodingVarintDelta), uint32(0))...),
+		"huge k":              encodeFields(append(header(64, 1<<40), uint8(EncodingDense), uint32(1), uint64(0))...),
+		"unknown flags": encodeFields(uint8(binaryVersion), uint64(64), uint64(1), uint64(0), uint64(0), uint32(0),
+			uint8(4), uint32(0), uint8(EncodingDense), uint32(1), uint64(0)),
+		"partitioned m below k": encodeFields(uint8(binaryVersion), uint64(2), uint64(3), uint64(0), uint64(0), uint32(0),
+			flagPartitioned, uint32(0), uint8(EncodingDense), uint32(1), uint64(0)),
+	}
+	for name, data := range tests {
+		var decoded DistBF
+		if err := decoded.UnmarshalBinary(data); err == nil {
+			t.Fatalf("%s: UnmarshalBinary should fail", name)
+		}
+		// a reader without Len is read in chunks
+		if _, err := ReadDbf(io.MultiReader(bytes.NewReader(data))); err == nil {
+			t.Fatalf("%s: ReadDbf should fail", name)
+		}
+	}
+	var decoded DistBF
+	if err := json.Unmarshal([]byte(`{"m": 8, "k": 1099511627776, "seed": "c2VlZA==", "bits": "AA=="}`), &decoded); err == nil {
+		t.Fatal("json with a huge k should fail")
+	}
+	valid := encodeFields(append(header(10, 1), uint8(EncodingDense), uint32(1), uint64(0x3ff))...)
+	if err := decoded.UnmarshalBinary(valid); err != nil || decoded.Count() != 10 {
+		t.Fatalf("all m bits set should decode, got %v", err)
+	}
+}
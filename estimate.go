@@ -0,0 +1,141 @@
+package DBF
+
+import (
+	"math"
+)
+
+// EstimateCardinality estimates the number of distinct elements added to DBF from the number of set bits X,
+// using the Swamidass-Baldi estimator n = -(m/k) * ln(1 - X/m).
+// The estimate degrades as the DBF saturates, when every bit is set it returns (m/k) * ln(m),
+// the estimate for X = m-1, instead of +Inf.
+func (dbf *DistBF) EstimateCardinality() float64 {
+	return estimateCardinality(dbf.m, dbf.k, dbf.Count())
+}
+
+func estimateCardinality(m, k, setBits uint) float64 {
+	x := float64(setBits)
+	if x >= float64(m) {
+		x = float64(m) - 1
+	}
+	return -float64(m) / float64(k) * math.Log(1-x/float64(m))
+}
+
+// EstimatedFPR returns the current false positive probability (X/m)^k of DBF, where X is the number of set bits
+func (dbf *DistBF) EstimatedFPR() float64 {
+	fpr := math.Pow(float64(dbf.Count())/float64(dbf.m), float64(dbf.k))
+	return math.Min(fpr, 1)
+}
+
+// JaccardEstimate estimates |A∩B|/|A∪B| of the sets added to both DBFs, which must have the same m, k and seed.
+// The cardinalities of A, B and A∪B are estimated from the set bits of each DBF and of their OR, which is
+// counted as X_A + X_B - X_(A AND B), and |A∩B| = |A| + |B| - |A∪B|. Like EstimateCardinality the estimate
+// degrades as the DBFs saturate, and it is noisy for small sets or small overlaps. It is 0 if both are empty.
+func (dbf *DistBF) JaccardEstimate(other *DistBF) (float64, error) {
+	if err := dbf.checkCompatible(other); err != nil {
+		return 0, err
+	}
+	x, otherX := dbf.Count(), other.Count()
+	unionX := x + otherX - dbf.b.IntersectionCardinality(other.b)
+	union := estimateCardinality(dbf.m, dbf.k, unionX)
+	if union == 0 {
+		return 0, nil
+	}
+	intersection := estimateCardinality(dbf.m, dbf.k, x) + estimateCardinality(dbf.m, dbf.k, otherX) - union
+	return math.Max(0, math.Min(1, intersection/union)), nil
+}
+
+// EstimateSymmetricDifference estimates how many elements are in only one of the DBFs, both must have the same
+// m, k and seed. With the cardinalities estimated like JaccardEstimate, |A△B| = |A| + |B| - 2|A∩B|, which is
+// 2|A∪B| - |A| - |B|. It is clamped at 0 and shares the noise of JaccardEstimate.
+func (dbf *DistBF) EstimateSymmetricDifference(other *DistBF) (float64, error) {
+	if err := dbf.checkCompatible(other); err != nil {
+		return 0, err
+	}
+	x, otherX := dbf.Count(), other.Count()
+	unionX := x + otherX - dbf.b.IntersectionCardinality(other.b)
+	union := estimateCardinality(dbf.m, dbf.k, unionX)
+	return math.Max(0, 2*union-estimateCardinality(dbf.m, dbf.k, x)-estimateCardinality(dbf.m, dbf.k, otherX)), nil
+}
+
+// FillRatio returns the fraction Count()/m of set bits, about 0.5 once a DBF holds the n elements it was sized for
+func (dbf *DistBF) FillRatio() float64 {
+	return float64(dbf.Count()) / float64(dbf.m)
+}
+
+// RemainingCapacity estimates how many more distinct elements can be added before the false positive rate of
+// DBF exceeds targetFPR, from Capacity at targetFPR and EstimateCardinality. It is 0 once the target is exceeded.
+func (dbf *DistBF) RemainingCapacity(targetFPR float64) uint {
+	if dbf.EstimatedFPR() >= targetFPR {
+		return 0
+	}
+	remaining := float64(Capacity(dbf.m, dbf.k, targetFPR)) - dbf.EstimateCardinality()
+	if remaining <= 0 {
+		return 0
+	}
+	return uint(remaining)
+}
+
+// OptimalK returns the number of hashes that minimizes the false positive rate for m and the n the DBF was
+// sized for, rounded up like EstimateParameters. It is 0 if n is not known, as for NewDbfWithParams or a DBF
+// decoded from version 3 data. Compare it with NumOfHashes to detect a suboptimal k.
+func (dbf *DistBF) OptimalK() uint {
+	if dbf.n == 0 {
+		return 0
+	}
+	return uint(math.Ceil(math.Log(2) * float64(dbf.m) / float64(dbf.n)))
+}
+
+// DesignCapacity returns the number of elements n DBF was sized for, kept by the binary and JSON encodings,
+// 0 if it is not known as for NewDbfWithParams. Comparing it with EstimateCardinality shows over-filled DBFs.
+func (dbf *DistBF) DesignCapacity() uint {
+	return dbf.n
+}
+
+// TargetFPR returns the false positive rate DBF was sized for, kept like DesignCapacity, 0 if not known.
+// Comparing it with EstimatedFPR shows DBFs that no longer meet their target.
+func (dbf *DistBF) TargetFPR() float64 {
+	return dbf.fpr
+}
+
+// CollisionProbability returns the probability that b maps to exactly the distinct indices of a by chance, and
+// vice versa, averaged over both directions. For s distinct indices of a, the k indices of an element are
+// uniform over m, so the probability that they cover exactly those s indices is surj(k, s) / m^k where
+// surj(k, s) = s! S(k, s) is the number of ways k draws cover all of s indices, S being the Stirling number of
+// the second kind. In a partitioned DBF index j is uniform over partition j of m/k bits instead, so the k
+// indices must each hit the one index of their partition, with probability (k/m)^k for m a multiple of k.
+func (dbf *DistBF) CollisionProbability(a, b []byte) float64 {
+	if dbf.partitioned {
+		return math.Pow(1/float64(dbf.m/dbf.k), float64(dbf.k))
+	}
+	sa := distinctIndices(dbf.GetElementIndices(a))
+	sb := distinctIndices(dbf.GetElementIndices(b))
+	return (collisionProbability(dbf.m, dbf.k, sa) + collisionProbability(dbf.m, dbf.k, sb)) / 2
+}
+
+// collisionProbability returns surj(k, s) / m^k, the probability that k uniform indices out of m are exactly a
+// given set of s indices
+func collisionProbability(m, k, s uint) float64 {
+	if s == 0 || s > k || s > m {
+		return 0
+	}
+	// p[c] is the probability that the indices so far are all in the set and cover c of its indices
+	p := make([]float64, s+1)
+	p[0] = 1
+	for i := uint(0); i < k; i++ {
+		for c := s; c > 0; c-- {
+			p[c] = p[c]*float64(c)/float64(m) + p[c-1]*float64(s-c+1)/float64(m)
+		}
+		p[0] = 0
+	}
+	return p[s]
+}
+
+func distinctIndices(indices []uint) uint {
+	var s uint
+	for i, index := range indices {
+		if !containsIndex(indices[:i], index) {
+			s++
+		}
+	}
+	return s
+}
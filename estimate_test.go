@@ -0,0 +1,183 @@
+package DBF
+
+import (
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEstimateCardinality(t *testing.T) {
+	dbf := NewDbf(1000, 0.01, []byte("seed"))
+	if dbf.EstimateCardinality() != 0 {
+		t.Fatal("empty dbf should have cardinality 0")
+	}
+	n := 300
+	for i := 0; i < n; i++ {
+		dbf.Add([]byte(fmt.Sprintf("element-%d", i)))
+	}
+	if estimate := dbf.EstimateCardinality(); math.Abs(estimate-float64(n)) > 0.1*float64(n) {
+		t.Fatalf("estimated cardinality %f is too far from %d", estimate, n)
+	}
+}
+
+func TestEstimateCardinalitySaturated(t *testing.T) {
+	dbf := NewDbf(10, 0.1, []byte("seed"))
+	for i := uint(0); i < dbf.m; i++ {
+		dbf.b.Set(i)
+	}
+	if estimate := dbf.EstimateCardinality(); math.IsInf(estimate, 0) || math.IsNaN(estimate) {
+		t.Fatal("saturated dbf should have a finite cardinality estimate")
+	}
+}
+
+func TestEstimatedFPR(t *testing.T) {
+	n, fpr := 1000, 0.05
+	dbf := NewDbf(uint(n), fpr, []byte("seed"))
+	if dbf.EstimatedFPR() != 0 {
+		t.Fatal("empty dbf should have a false positive rate of 0")
+	}
+	for i := 0; i < n; i++ {
+		dbf.Add([]byte(fmt.Sprintf("element-%d", i)))
+	}
+	if estimate := dbf.EstimatedFPR(); estimate < fpr/2 || estimate > fpr*2 {
+		t.Fatalf("estimated false positive rate %f is too far from %f", estimate, fpr)
+	}
+	for i := uint(0); i < dbf.m; i++ {
+		dbf.b.Set(i)
+	}
+	if dbf.EstimatedFPR() != 1 {
+		t.Fatal("saturated dbf should have a false positive rate of 1")
+	}
+}
+
+func TestJaccardEstimate(t *testing.T) {
+	dbf1 := NewDbf(1000, 0.01, []byte("seed"))
+	dbf2 := NewDbf(1000, 0.01, []byte("seed"))
+	// A = [0, 300) and B = [150, 450) share 150 of 450 elements
+	for i := 0; i < 300; i++ {
+		dbf1.Add([]byte(fmt.Sprintf("element-%d", i)))
+		dbf2.Add([]byte(fmt.Sprintf("element-%d", i+150)))
+	}
+	estimate, err := dbf1.JaccardEstimate(dbf2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(estimate-1.0/3) > 0.05 {
+		t.Fatalf("jaccard estimate %f is too far from %f", estimate, 1.0/3)
+	}
+	if estimate, _ := dbf1.JaccardEstimate(dbf1); math.Abs(estimate-1) > 1e-9 {
+		t.Fatal("jaccard estimate of a dbf with itself should be 1")
+	}
+	if _, err := dbf1.JaccardEstimate(NewDbf(1000, 0.01, []byte("other seed"))); err == nil {
+		t.Fatal("jaccard estimate of dbfs with different seeds should fail")
+	}
+}
+
+func TestEstimateSymmetricDifference(t *testing.T) {
+	dbf1 := NewDbf(1000, 0.01, []byte("seed"))
+	dbf2 := NewDbf(1000, 0.01, []byte("seed"))
+	// A = [0, 400) and B = [300, 700) differ in 300 + 300 elements
+	for i := 0; i < 400; i++ {
+		dbf1.Add([]byte(fmt.Sprintf("element-%d", i)))
+		dbf2.Add([]byte(fmt.Sprintf("element-%d", i+300)))
+	}
+	estimate, err := dbf1.EstimateSymmetricDifference(dbf2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(estimate-600)/600 > 0.1 {
+		t.Fatalf("symmetric difference estimate %f is too far from 600", estimate)
+	}
+	if estimate, _ := dbf1.EstimateSymmetricDifference(dbf1); estimate != 0 {
+		t.Fatal("symmetric difference of a dbf with itself should be 0")
+	}
+	if _, err := dbf1.EstimateSymmetricDifference(NewDbf(1000, 0.01, []byte("other seed"))); err == nil {
+		t.Fatal("symmetric difference of dbfs with different seeds should fail")
+	}
+}
+
+func TestFillRatio(t *testing.T) {
+	n := 1000
+	dbf := NewDbf(uint(n), 0.01, []byte("seed"))
+	if dbf.FillRatio() != 0 {
+		t.Fatal("empty dbf should have a fill ratio of 0")
+	}
+	for i := 0; i < n; i++ {
+		dbf.Add([]byte(fmt.Sprintf("element-%d", i)))
+	}
+	if fill := dbf.FillRatio(); math.Abs(fill-0.5) > 0.05 {
+		t.Fatalf("fill ratio %f of a dbf holding n elements should be about 0.5", fill)
+	}
+}
+
+func TestRemainingCapacity(t *testing.T) {
+	n, fpr := 1000, 0.01
+	dbf := NewDbf(uint(n), fpr, []byte("seed"))
+	remaining := dbf.RemainingCapacity(fpr)
+	if math.Abs(float64(remaining)-float64(n)) > 0.1*float64(n) {
+		t.Fatalf("remaining capacity %d of an empty dbf should be about %d", remaining, n)
+	}
+	for i := 0; i < 2*n; i++ {
+		dbf.Add([]byte(fmt.Sprintf("element-%d", i)))
+		next := dbf.RemainingCapacity(fpr)
+		if next > remaining {
+			t.Fatal("remaining capacity should not increase when adding elements")
+		}
+		remaining = next
+	}
+	if remaining != 0 {
+		t.Fatal("remaining capacity of an over-filled dbf should be 0")
+	}
+}
+
+func TestOptimalK(t *testing.T) {
+	for _, n := range []uint{1, 10, 1000, 100000} {
+		for _, fpr := range []float64{0.5, 0.1, 0.01, 0.0001} {
+			_, k := EstimateParameters(n, fpr)
+			if got := NewDbf(n, fpr, []byte("seed")).OptimalK(); got != k {
+				t.Fatalf("n=%d fpr=%v: OptimalK %d should match k %d of EstimateParameters", n, fpr, got, k)
+			}
+		}
+	}
+	dbf := NewDbfWithOptions(1000, 0.01, WithSeed([]byte("seed")), WithEstimatedParameters(9586, 2))
+	assert.Equal(t, uint(7), dbf.OptimalK())
+	assert.Equal(t, uint(0), NewDbfWithParams(9586, 7, []byte("seed")).OptimalK())
+}
+
+func TestCollisionProbability(t *testing.T) {
+	// m=4 k=2: 2 distinct indices are hit in 2 of the 16 ordered pairs, 1 index in 1 of them
+	assert.InDelta(t, 2.0/16, collisionProbability(4, 2, 2), 1e-12)
+	assert.InDelta(t, 1.0/16, collisionProbability(4, 2, 1), 1e-12)
+	// m=10 k=3: 3!=6 ways for 3 distinct indices, 3*2=6 surjections onto 2 indices
+	assert.InDelta(t, 6.0/1000, collisionProbability(10, 3, 3), 1e-12)
+	assert.InDelta(t, 6.0/1000, collisionProbability(10, 3, 2), 1e-12)
+	assert.InDelta(t, 1.0/1000, collisionProbability(10, 3, 1), 1e-12)
+	assert.Equal(t, 0.0, collisionProbability(10, 3, 4))
+
+	dbf := NewDbfWithParams(10, 3, []byte("seed"))
+	a, b := []byte("a"), []byte("b")
+	sa := distinctIndices(dbf.GetElementIndices(a))
+	sb := distinctIndices(dbf.GetElementIndices(b))
+	expected := (collisionProbability(10, 3, sa) + collisionProbability(10, 3, sb)) / 2
+	assert.InDelta(t, expected, dbf.CollisionProbability(a, b), 1e-12)
+	assert.Equal(t, dbf.CollisionProbability(a, b), dbf.CollisionProbability(b, a))
+
+	// m=17 k=3 partitioned: 3 partitions of 5 bits, each index has to match its partition's
+	partitioned := NewDbfWithOptions(1, 0.5, WithSeed([]byte("seed")), WithEstimatedParameters(17, 3), WithPartitioning())
+	assert.InDelta(t, 1.0/125, partitioned.CollisionProbability(a, b), 1e-12)
+	// the index triples of elements are close to uniform over the 5^3 possible ones
+	indices := make(map[[3]uint]int)
+	for i := 0; i < 125000; i++ {
+		var key [3]uint
+		copy(key[:], partitioned.GetElementIndices([]byte(fmt.Sprintf("element-%d", i))))
+		indices[key]++
+	}
+	assert.Len(t, indices, 125)
+	for key, count := range indices {
+		if count < 500 || count > 2000 {
+			t.Fatalf("index triple %v was hit %d times, expected about 1000", key, count)
+		}
+	}
+}
@@ -1,6 +1,6 @@
 module github.com/labbloom/DBF
 
-go 1.12
+go 1.13
 
 require (
 	github.com/arberiii/peer v0.0.0-20190924142933-3ac0dbfd4f14 // indirect
@@ -1,15 +1,19 @@
 package DBF
 
 import (
-	"crypto/sha512"
+	"hash"
 )
 
 // iHash returns the ith hashed value
-func iHash(data []byte, i int) [sha512.Size256]byte {
-	newData := append(data, byte(i))
-	return sha512.Sum512_256(newData)
+func iHash(hf func() hash.Hash, data []byte, i int) []byte {
+	h := hf()
+	h.Write(data)
+	h.Write([]byte{byte(i)})
+	return h.Sum(nil)
 }
 
-func hashElement(element []byte) [sha512.Size256]byte {
-	return sha512.Sum512_256(element)
+func hashElement(hf func() hash.Hash, element []byte) []byte {
+	h := hf()
+	h.Write(element)
+	return h.Sum(nil)
 }
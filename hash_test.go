@@ -11,23 +11,23 @@ func TestIHash(t *testing.T) {
 	// for this we want to Test that no two hashes are equal
 	data := []byte("message")
 	k := 10
-	hashes := make(map[[sha512.Size256]byte]bool)
+	hashes := make(map[string]bool)
 	for i := 0; i < k; i++ {
-		hash := iHash(data, i)
-		if ok := hashes[hash]; ok {
+		hash := iHash(sha512.New512_256, data, i)
+		if ok := hashes[string(hash)]; ok {
 			t.Fatal("hash previously existed")
 		} else {
-			hashes[hash] = true
+			hashes[string(hash)] = true
 		}
 	}
 }
 
 func TestHashElement(t *testing.T) {
 	element := []byte("message")
-	hash := hashElement(element)
+	hash := hashElement(sha512.New512_256, element)
 	want := [sha512.Size256]byte{14, 154, 200, 188, 223, 90, 235, 90, 3, 69, 16, 141, 94, 156, 154, 255, 169, 210, 86, 1, 3,
 		63, 112, 56, 107, 77, 53, 51, 212, 45, 16, 248}
 	t.Run("hash of element", func(t *testing.T) {
-		assert.Equalf(t, hash, want, "hashElement() = %v, want %v", hash, want)
+		assert.Equalf(t, hash, want[:], "hashElement() = %v, want %v", hash, want)
 	})
 }
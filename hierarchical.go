@@ -0,0 +1,62 @@
+package DBF
+
+// HierarchicalDistBF keeps one DBF per prefix length to test the membership of key prefixes, like the
+// networks of IP addresses. Level i holds the prefixes of (i+1)*granularity bytes of the added keys.
+type HierarchicalDistBF struct {
+	levels      []*DistBF
+	granularity int
+}
+
+// NewHierarchicalDbf returns the hierarchical DBF with levels DBFs for prefixes of granularity, 2*granularity
+// up to levels*granularity bytes, each sized for n prefixes at the false positive rate fpr.
+// It panics if levels or granularity is not positive.
+func NewHierarchicalDbf(n uint, fpr float64, s []byte, levels, granularity int) *HierarchicalDistBF {
+	if levels <= 0 || granularity <= 0 {
+		panic("DBF: levels and granularity must be greater than 0")
+	}
+	hdbf := &HierarchicalDistBF{granularity: granularity}
+	for i := 0; i < levels; i++ {
+		hdbf.levels = append(hdbf.levels, NewDbf(n, fpr, s))
+	}
+	return hdbf
+}
+
+// Add every prefix of key that falls on a level to its DBF, bytes of key beyond the last level are ignored
+func (hdbf *HierarchicalDistBF) Add(key []byte) {
+	for i, level := range hdbf.levels {
+		length := (i + 1) * hdbf.granularity
+		if length > len(key) {
+			return
+		}
+		level.Add(key[:length])
+	}
+}
+
+// Contains returns true if prefix is probably a prefix of an added key, false if it is definitely not or if
+// its length is not a level
+func (hdbf *HierarchicalDistBF) Contains(prefix []byte) bool {
+	i := len(prefix)/hdbf.granularity - 1
+	if len(prefix)%hdbf.granularity != 0 || i < 0 || i >= len(hdbf.levels) {
+		return false
+	}
+	return hdbf.levels[i].Contains(prefix)
+}
+
+// LongestPrefix returns the length of the longest prefix of key that is probably a prefix of an added key,
+// 0 if none is. Since levels are added together the search stops at the first level that misses.
+func (hdbf *HierarchicalDistBF) LongestPrefix(key []byte) int {
+	longest := 0
+	for i, level := range hdbf.levels {
+		length := (i + 1) * hdbf.granularity
+		if length > len(key) || !level.Contains(key[:length]) {
+			break
+		}
+		longest = length
+	}
+	return longest
+}
+
+// Levels returns the DBFs of the levels, shortest prefixes first
+func (hdbf *HierarchicalDistBF) Levels() []*DistBF {
+	return hdbf.levels
+}
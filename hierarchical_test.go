@@ -0,0 +1,40 @@
+package DBF
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHierarchicalDistBF(t *testing.T) {
+	hdbf := NewHierarchicalDbf(100, 0.001, []byte("seed"), 4, 1)
+	hdbf.Add([]byte{10, 1, 2, 3})
+	hdbf.Add([]byte{192, 168, 0, 1})
+	for _, prefix := range [][]byte{{10}, {10, 1}, {10, 1, 2}, {10, 1, 2, 3}, {192, 168}, {192, 168, 0, 1}} {
+		if !hdbf.Contains(prefix) {
+			t.Fatalf("prefix %v of an added key should be contained", prefix)
+		}
+	}
+	for _, prefix := range [][]byte{{11}, {10, 2}, {192, 168, 1}, {}, {10, 1, 2, 3, 4}} {
+		if hdbf.Contains(prefix) {
+			t.Fatalf("prefix %v should not be contained", prefix)
+		}
+	}
+	assert.Equal(t, 3, hdbf.LongestPrefix([]byte{10, 1, 2, 99}))
+	assert.Equal(t, 4, hdbf.LongestPrefix([]byte{192, 168, 0, 1}))
+	assert.Equal(t, 0, hdbf.LongestPrefix([]byte{172, 16, 0, 1}))
+	assert.Len(t, hdbf.Levels(), 4)
+}
+
+func TestHierarchicalDistBFGranularity(t *testing.T) {
+	hdbf := NewHierarchicalDbf(100, 0.001, []byte("seed"), 3, 2)
+	hdbf.Add([]byte("abcdefgh"))
+	if !hdbf.Contains([]byte("ab")) || !hdbf.Contains([]byte("abcdef")) {
+		t.Fatal("prefixes on a level should be contained")
+	}
+	if hdbf.Contains([]byte("abc")) || hdbf.Contains([]byte("abcdefgh")) {
+		t.Fatal("prefixes between or beyond the levels should not be contained")
+	}
+	assert.Equal(t, 6, hdbf.LongestPrefix([]byte("abcdefgh")))
+	assert.Panics(t, func() { NewHierarchicalDbf(100, 0.001, []byte("seed"), 0, 1) })
+}
@@ -0,0 +1,48 @@
+package DBF
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+
+	"github.com/willf/bloom"
+)
+
+// FromWillfBloom converts a willf/bloom filter into a DBF with the same m and k and the seed s.
+// willf/bloom maps elements with murmur3 and double hashing while a DBF maps them with its seed hashes,
+// so the bits of f cannot be copied: only m and k are preserved and the elements must be added again.
+// Every element must be contained in f, and converting a non-empty f without elements returns an error.
+// The resulting DBF answers Contains only for the given elements, it cannot recover false positives of f.
+func FromWillfBloom(f *bloom.BloomFilter, s []byte, elements [][]byte) (*DistBF, error) {
+	if len(elements) == 0 && !willfBloomEmpty(f) {
+		return nil, errors.New("DBF: the bits of a willf/bloom filter cannot be converted, its elements are needed")
+	}
+	dbf := NewDbfWithParams(f.Cap(), f.K(), s)
+	for i, elem := range elements {
+		if !f.Test(elem) {
+			return nil, fmt.Errorf("DBF: element %d is not in the willf/bloom filter", i)
+		}
+		dbf.Add(elem)
+	}
+	return dbf, nil
+}
+
+// willfBloomEmpty returns true if no bit of f is set. willf/bloom v2 does not export its bit set, and copying
+// it with WriteTo or comparing f to an empty filter allocates m bits, so the words of the bit set are read
+// through reflection instead. Should its unexported fields change, it falls back to the comparison.
+func willfBloomEmpty(f *bloom.BloomFilter) bool {
+	b := reflect.ValueOf(f).Elem().FieldByName("b")
+	if b.Kind() != reflect.Ptr || b.IsNil() || b.Elem().Kind() != reflect.Struct {
+		return f.Equal(bloom.New(f.Cap(), f.K()))
+	}
+	set := b.Elem().FieldByName("set")
+	if set.Kind() != reflect.Slice || set.Type().Elem().Kind() != reflect.Uint64 {
+		return f.Equal(bloom.New(f.Cap(), f.K()))
+	}
+	for i := 0; i < set.Len(); i++ {
+		if set.Index(i).Uint() != 0 {
+			return false
+		}
+	}
+	return true
+}
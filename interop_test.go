@@ -0,0 +1,48 @@
+package DBF
+
+import (
+	"testing"
+
+	"github.com/willf/bloom"
+)
+
+func TestFromWillfBloom(t *testing.T) {
+	f := bloom.NewWithEstimates(100, 0.1)
+	elements := [][]byte{[]byte("something"), []byte("something else")}
+	for _, elem := range elements {
+		f.Add(elem)
+	}
+	dbf, err := FromWillfBloom(f, []byte("seed"), elements)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dbf.m != f.Cap() || dbf.k != f.K() {
+		t.Fatal("converted dbf should have the m and k of the willf/bloom filter")
+	}
+	if !dbf.ContainsAll(elements) {
+		t.Fatal("converted dbf should contain the elements")
+	}
+	if _, err := FromWillfBloom(f, []byte("seed"), nil); err == nil {
+		t.Fatal("converting a filter without its elements should fail")
+	}
+	if _, err := FromWillfBloom(f, []byte("seed"), [][]byte{[]byte("not added")}); err == nil {
+		t.Fatal("converting with an element that is not in the filter should fail")
+	}
+	if _, err := FromWillfBloom(bloom.NewWithEstimates(100, 0.1), []byte("seed"), nil); err != nil {
+		t.Fatal("converting an empty filter should not need elements")
+	}
+}
+
+func TestWillfBloomEmpty(t *testing.T) {
+	f := bloom.New(1<<20, 5)
+	if !willfBloomEmpty(f) {
+		t.Fatal("a new filter should be empty")
+	}
+	if allocs := testing.AllocsPerRun(10, func() { willfBloomEmpty(f) }); allocs != 0 {
+		t.Fatalf("checking for an empty filter should not allocate, got %v allocations", allocs)
+	}
+	f.Add([]byte("something"))
+	if willfBloomEmpty(f) {
+		t.Fatal("a filter with an element should not be empty")
+	}
+}
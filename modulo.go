@@ -1,16 +1,40 @@
 package DBF
 
 import (
-	"crypto/sha512"
 	"encoding/binary"
 )
 
-func byteModuloM(m uint, hash [sha512.Size256]byte) uint {
-	x := uintFromBytes(hash[:]) % m
+func byteModuloM(m uint, hash []byte) uint {
+	x := uintFromBytes(hash) % m
 	return x
 }
 
+// byteModuloMLittleEndian reduces hash read like uintFromBytesLittleEndian modulo m
+func byteModuloMLittleEndian(m uint, hash []byte) uint {
+	return uintFromBytesLittleEndian(hash) % m
+}
+
+// uintFromBytes reads the first 8 bytes big endian, or all of them for shorter digests
 func uintFromBytes(bytes []byte) uint {
+	if len(bytes) < 8 {
+		var data uint64
+		for _, b := range bytes {
+			data = data<<8 | uint64(b)
+		}
+		return uint(data)
+	}
 	data := binary.BigEndian.Uint64(bytes)
 	return uint(data)
 }
+
+// uintFromBytesLittleEndian reads the first 8 bytes little endian, or all of them for shorter digests
+func uintFromBytesLittleEndian(bytes []byte) uint {
+	if len(bytes) < 8 {
+		var data uint64
+		for i := len(bytes) - 1; i >= 0; i-- {
+			data = data<<8 | uint64(bytes[i])
+		}
+		return uint(data)
+	}
+	return uint(binary.LittleEndian.Uint64(bytes))
+}
@@ -0,0 +1,195 @@
+package DBF
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/bits"
+)
+
+var (
+	// ErrIncompatibleParams is wrapped by the errors of operations on DBFs whose m, k or mapping options differ
+	ErrIncompatibleParams = errors.New("DBF: incompatible parameters")
+	// ErrSeedMismatch is wrapped by the errors of operations on DBFs whose seeds or domains differ
+	ErrSeedMismatch = errors.New("DBF: seed mismatch")
+)
+
+// checkCompatible returns an error wrapping ErrIncompatibleParams or ErrSeedMismatch if the two DBFs do not
+// share m, k and the seed hashes
+func (dbf *DistBF) checkCompatible(other *DistBF) error {
+	if dbf.m != other.m {
+		return fmt.Errorf("%w: bit array sizes m differ", ErrIncompatibleParams)
+	}
+	if dbf.k != other.k {
+		return fmt.Errorf("%w: number of hashes k differ", ErrIncompatibleParams)
+	}
+	if dbf.partitioned != other.partitioned {
+		return fmt.Errorf("%w: partitioning differs", ErrIncompatibleParams)
+	}
+	if dbf.littleEndian != other.littleEndian {
+		return fmt.Errorf("%w: index byte order differs", ErrIncompatibleParams)
+	}
+	if fp, otherFp := dbf.SeedFingerprint(), other.SeedFingerprint(); fp != otherFp {
+		return fmt.Errorf("%w: seed fingerprints differ: %x != %x", ErrSeedMismatch, fp[:8], otherFp[:8])
+	}
+	if !bytes.Equal(dbf.domain, other.domain) {
+		return fmt.Errorf("%w: domains differ", ErrSeedMismatch)
+	}
+	// with equal seeds and domains the seed hashes still differ if the hash functions do
+	h, otherH := dbf.hashes(), other.hashes()
+	for i := range h {
+		if !bytes.Equal(h[i], otherH[i]) {
+			return fmt.Errorf("%w: seed hashes differ, the hash functions do not match", ErrIncompatibleParams)
+		}
+	}
+	return nil
+}
+
+// Compatible returns true if the DBFs share m, k, the seed and the mapping options, so they can be combined
+// by the set operations, which fail with the reason otherwise
+func (dbf *DistBF) Compatible(other *DistBF) bool {
+	return dbf.checkCompatible(other) == nil
+}
+
+// Union sets the bits of other DBF in DBF, both DBFs must have the same m, k and seed
+func (dbf *DistBF) Union(other *DistBF) error {
+	if dbf.frozen {
+		return ErrFrozen
+	}
+	if err := dbf.checkCompatible(other); err != nil {
+		return err
+	}
+	dbf.b.InPlaceUnion(other.b)
+	dbf.forgetSetBits()
+	if dbf.summary != nil && other.summary != nil && dbf.summaryBits == other.summaryBits {
+		dbf.summary.InPlaceUnion(other.summary)
+	} else {
+		dbf.dropSummary()
+	}
+	return nil
+}
+
+// UnionPrefix sets the bits of other DBF in DBF when other uses more hashes over the same seed hashes. The
+// seed hash i only depends on the seed, the domain and i, so a DBF with k hashes shares the first k seed
+// hashes with any DBF that has the same seed and more hashes, and an element of other set, among its bits,
+// every bit it would set in DBF. The bits cannot be told apart by the hash that set them, so all bits of other
+// are merged: DBF then contains every element of other, but the bits of the hashes beyond the k of DBF raise
+// its fill ratio and false positive rate more than adding the elements would.
+// The preconditions are the same m, at least as many hashes in other as in DBF, equal first k seed hashes,
+// the same byte order, and neither DBF partitioned, since partitions depend on k.
+// It returns ErrIncompatibleParams or ErrSeedMismatch when they do not hold.
+func (dbf *DistBF) UnionPrefix(other *DistBF) error {
+	if dbf.frozen {
+		return ErrFrozen
+	}
+	if dbf.m != other.m {
+		return fmt.Errorf("%w: bit array sizes m differ", ErrIncompatibleParams)
+	}
+	if other.k < dbf.k {
+		return fmt.Errorf("%w: other has k=%d hashes, fewer than k=%d", ErrIncompatibleParams, other.k, dbf.k)
+	}
+	if dbf.partitioned || other.partitioned {
+		return fmt.Errorf("%w: partitioned filters cannot merge a prefix", ErrIncompatibleParams)
+	}
+	if dbf.littleEndian != other.littleEndian {
+		return fmt.Errorf("%w: index byte order differs", ErrIncompatibleParams)
+	}
+	h, otherH := dbf.hashes(), other.hashes()
+	for i := range h {
+		if !bytes.Equal(h[i], otherH[i]) {
+			return fmt.Errorf("%w: seed hash %d differs", ErrSeedMismatch, i)
+		}
+	}
+	dbf.b.InPlaceUnion(other.b)
+	dbf.dropSummary()
+	return nil
+}
+
+// OrWords sets the bits of words in DBF, words must be laid out like Words: ceil(m/64) words with no bits set
+// beyond m in the last one
+func (dbf *DistBF) OrWords(words []uint64) error {
+	if dbf.frozen {
+		return ErrFrozen
+	}
+	own := dbf.b.Bytes()
+	if len(words) != len(own) {
+		return fmt.Errorf("%w: got %d words, want %d for m=%d", ErrIncompatibleParams, len(words), len(own), dbf.m)
+	}
+	if n := len(words); dbf.m%64 != 0 && n > 0 && words[n-1]>>(dbf.m%64) != 0 {
+		return fmt.Errorf("DBF: bits set beyond m=%d", dbf.m)
+	}
+	dbf.dropSummary()
+	for i, word := range words {
+		own[i] |= word
+	}
+	return nil
+}
+
+// Intersect keeps only the bits that are set in both DBFs, both DBFs must have the same m, k and seed.
+// The result over-approximates the intersection of the two sets: it contains every element that was
+// added to both DBFs, but it can also report elements that were in neither, since their bits may have
+// been set by different elements in each DBF.
+func (dbf *DistBF) Intersect(other *DistBF) error {
+	if dbf.frozen {
+		return ErrFrozen
+	}
+	if err := dbf.checkCompatible(other); err != nil {
+		return err
+	}
+	dbf.b.InPlaceIntersection(other.b)
+	dbf.forgetSetBits()
+	return nil
+}
+
+// Equals returns true if both DBFs have the same m, k, seed and bit array
+func (dbf *DistBF) Equals(other *DistBF) bool {
+	return dbf.Compatible(other) && dbf.b.Equal(other.b)
+}
+
+// Difference returns a new DBF with the bits of DBF that are not set in other, both must have the same m, k and seed.
+// It is only a coarse approximation of A minus B: an element of A that is not in B loses every bit it shares
+// with an element of B, so the result can miss elements of A minus B as well as keep some of B.
+func (dbf *DistBF) Difference(other *DistBF) (*DistBF, error) {
+	if err := dbf.checkCompatible(other); err != nil {
+		return nil, err
+	}
+	diff := dbf.Clone()
+	diff.b.InPlaceDifference(other.b)
+	return diff, nil
+}
+
+// UnionPreview returns the number of bits set in the union of DBF and others without computing it, so the fill
+// ratio setBits/m and the false positive rate (setBits/m)^k of a merge can be checked before merging. All
+// filters must be compatible with DBF, none is changed and no merged copy is allocated.
+func (dbf *DistBF) UnionPreview(others ...*DistBF) (setBits uint, err error) {
+	for i, other := range others {
+		if err := dbf.checkCompatible(other); err != nil {
+			return 0, fmt.Errorf("DBF: filter %d: %w", i+1, err)
+		}
+	}
+	for i, word := range dbf.b.Bytes() {
+		for _, other := range others {
+			// a bit array from SetBitSet may be shorter
+			if words := other.b.Bytes(); i < len(words) {
+				word |= words[i]
+			}
+		}
+		setBits += uint(bits.OnesCount64(word))
+	}
+	return setBits, nil
+}
+
+// MergeMany returns a new DBF with the union of all filters, which must have the same m, k and seed.
+// The filters are not changed, and at least one filter is needed.
+func MergeMany(filters ...*DistBF) (*DistBF, error) {
+	if len(filters) == 0 {
+		return nil, errors.New("DBF: no filters to merge")
+	}
+	merged := filters[0].Clone()
+	for i, other := range filters[1:] {
+		if err := merged.Union(other); err != nil {
+			return nil, fmt.Errorf("DBF: filter %d: %w", i+1, err)
+		}
+	}
+	return merged, nil
+}
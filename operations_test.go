@@ -0,0 +1,508 @@
+package DBF
+
+import (
+	"crypto/sha512"
+	"errors"
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/willf/bitset"
+)
+
+func TestUnion(t *testing.T) {
+	dbf1 := NewDbf(100, 0.1, []byte("seed"))
+	dbf2 := NewDbf(100, 0.1, []byte("seed"))
+	element1 := []byte("something")
+	element2 := []byte("something else")
+	dbf1.Add(element1)
+	dbf2.Add(element2)
+	if err := dbf1.Union(dbf2); err != nil {
+		t.Fatal(err)
+	}
+	if !dbf1.Contains(element1) || !dbf1.Contains(element2) {
+		t.Fatal("union should contain the elements of both dbfs")
+	}
+}
+
+func TestUnionIncompatible(t *testing.T) {
+	dbf := NewDbf(100, 0.1, []byte("seed"))
+	if err := dbf.Union(NewDbf(200, 0.1, []byte("seed"))); err == nil {
+		t.Fatal("union of dbfs with different m should fail")
+	}
+	other := &DistBF{m: dbf.m, k: dbf.k + 1, h: seedHashes(sha512.New512_256, []byte("seed"), dbf.k+1), b: bitset.New(dbf.m)}
+	if err := dbf.Union(other); err == nil {
+		t.Fatal("union of dbfs with different k should fail")
+	}
+	if err := dbf.Union(NewDbf(100, 0.1, []byte("other seed"))); err == nil {
+		t.Fatal("union of dbfs with different seeds should fail")
+	}
+}
+
+func TestCompatible(t *testing.T) {
+	dbf := NewDbfWithParams(1000, 5, []byte("seed"))
+	if !dbf.Compatible(NewDbfWithParams(1000, 5, []byte("seed"))) {
+		t.Fatal("DBFs with the same parameters should be compatible")
+	}
+	incompatible := map[string]*DistBF{
+		"m":    NewDbfWithParams(1001, 5, []byte("seed")),
+		"k":    NewDbfWithParams(1000, 6, []byte("seed")),
+		"seed": NewDbfWithParams(1000, 5, []byte("other seed")),
+		"hash": newDbf(1000, 5, []Option{WithSeed([]byte("seed")), WithHash(sha512.New)}),
+	}
+	for name, other := range incompatible {
+		if dbf.Compatible(other) || other.Compatible(dbf) {
+			t.Fatalf("DBFs with different %s should not be compatible", name)
+		}
+	}
+}
+
+func TestOrWords(t *testing.T) {
+	dbf1 := NewDbf(100, 0.1, []byte("seed"))
+	dbf2 := NewDbf(100, 0.1, []byte("seed"))
+	dbf1.Add([]byte("something"))
+	dbf2.Add([]byte("something else"))
+	union := dbf1.Clone()
+	if err := union.Union(dbf2); err != nil {
+		t.Fatal(err)
+	}
+	if err := dbf1.OrWords(dbf2.Words()); err != nil {
+		t.Fatal(err)
+	}
+	if !dbf1.Equals(union) {
+		t.Fatal("OrWords of the words of other should equal Union with other")
+	}
+	if err := dbf1.OrWords(make([]uint64, len(dbf1.Words())+1)); err == nil {
+		t.Fatal("words of a different length should fail")
+	}
+	beyond := make([]uint64, len(dbf1.Words()))
+	beyond[len(beyond)-1] = 1 << 63
+	if err := dbf1.OrWords(beyond); err == nil {
+		t.Fatal("words with bits beyond m should fail")
+	}
+	if !dbf1.Equals(union) {
+		t.Fatal("failed OrWords should not change the dbf")
+	}
+}
+
+func TestUnionPrefix(t *testing.T) {
+	seed := []byte("seed")
+	small := NewDbfWithParams(10000, 5, seed)
+	large := NewDbfWithParams(10000, 8, seed)
+	assert.Equal(t, small.SeedHashes(), large.SeedHashes()[:5])
+	elements := batchElements(200)
+	for _, elem := range elements[:100] {
+		small.Add(elem)
+	}
+	for _, elem := range elements[100:] {
+		large.Add(elem)
+		assert.Equal(t, small.GetElementIndices(elem), large.GetElementIndices(elem)[:5])
+	}
+	if err := small.UnionPrefix(large); err != nil {
+		t.Fatal(err)
+	}
+	for _, elem := range elements {
+		if !small.Contains(elem) {
+			t.Fatal("elements of both dbfs should be contained after UnionPrefix")
+		}
+	}
+
+	if err := large.UnionPrefix(small); !errors.Is(err, ErrIncompatibleParams) {
+		t.Fatalf("other with fewer hashes should fail with ErrIncompatibleParams, got %v", err)
+	}
+	if err := small.UnionPrefix(NewDbfWithParams(10000, 8, []byte("other seed"))); !errors.Is(err, ErrSeedMismatch) {
+		t.Fatalf("other with a different seed should fail with ErrSeedMismatch, got %v", err)
+	}
+	incompatible := []*DistBF{
+		NewDbfWithParams(20000, 8, seed),
+		newDbf(10000, 8, []Option{WithSeed(seed), WithPartitioning()}),
+	}
+	for _, other := range incompatible {
+		if err := small.UnionPrefix(other); !errors.Is(err, ErrIncompatibleParams) {
+			t.Fatalf("UnionPrefix should fail with ErrIncompatibleParams, got %v", err)
+		}
+	}
+}
+
+func TestIncompatibleErrors(t *testing.T) {
+	dbf := NewDbfWithParams(1000, 5, []byte("seed"))
+	cases := []struct {
+		name  string
+		other *DistBF
+		want  error
+	}{
+		{"m", NewDbfWithParams(1001, 5, []byte("seed")), ErrIncompatibleParams},
+		{"k", NewDbfWithParams(1000, 6, []byte("seed")), ErrIncompatibleParams},
+		{"partitioning", newDbf(1000, 5, []Option{WithSeed([]byte("seed")), WithPartitioning()}), ErrIncompatibleParams},
+		{"hash", newDbf(1000, 5, []Option{WithSeed([]byte("seed")), WithHash(sha512.New)}), ErrIncompatibleParams},
+		{"seed", NewDbfWithParams(1000, 5, []byte("other seed")), ErrSeedMismatch},
+		{"domain", newDbf(1000, 5, []Option{WithSeed([]byte("seed")), WithDomain([]byte("domain"))}), ErrSeedMismatch},
+	}
+	for _, c := range cases {
+		operations := map[string]func() error{
+			"Union":     func() error { return dbf.Union(c.other) },
+			"Intersect": func() error { return dbf.Intersect(c.other) },
+			"Difference": func() error {
+				_, err := dbf.Difference(c.other)
+				return err
+			},
+			"MergeMany": func() error {
+				_, err := MergeMany(dbf, c.other)
+				return err
+			},
+			"JaccardEstimate": func() error {
+				_, err := dbf.JaccardEstimate(c.other)
+				return err
+			},
+		}
+		for name, operation := range operations {
+			if err := operation(); !errors.Is(err, c.want) {
+				t.Fatalf("%s with a different %s should fail with %v, got %v", name, c.name, c.want, err)
+			}
+		}
+	}
+	if err := dbf.OrWords(make([]uint64, 1)); !errors.Is(err, ErrIncompatibleParams) {
+		t.Fatalf("OrWords with the wrong length should fail with ErrIncompatibleParams, got %v", err)
+	}
+	full := NewDbfWithOptions(10, 0.1, WithSeed([]byte("seed")), WithMaxFillRatio(0.01))
+	full.Add([]byte("something"))
+	if err := full.AddChecked([]byte("something else")); !errors.Is(err, ErrFilterFull) {
+		t.Fatalf("AddChecked on a full dbf should fail with ErrFilterFull, got %v", err)
+	}
+}
+
+func TestIntersect(t *testing.T) {
+	dbf1 := NewDbf(100, 0.1, []byte("seed"))
+	dbf2 := NewDbf(100, 0.1, []byte("seed"))
+	shared := []byte("shared")
+	element1 := []byte("something")
+	element2 := []byte("something else")
+	dbf1.Add(shared)
+	dbf1.Add(element1)
+	dbf2.Add(shared)
+	dbf2.Add(element2)
+	if err := dbf1.Intersect(dbf2); err != nil {
+		t.Fatal(err)
+	}
+	if !dbf1.Contains(shared) {
+		t.Fatal("intersection should contain the shared element")
+	}
+	if dbf1.Contains(element1) || dbf1.Contains(element2) {
+		t.Fatal("intersection should not contain elements of only one dbf")
+	}
+	if err := dbf1.Intersect(NewDbf(100, 0.1, []byte("other seed"))); err == nil {
+		t.Fatal("intersection of dbfs with different seeds should fail")
+	}
+}
+
+func TestIntersectEmpty(t *testing.T) {
+	dbf := NewDbf(100, 0.1, []byte("seed"))
+	dbf.Add([]byte("something"))
+	if err := dbf.Intersect(NewDbf(100, 0.1, []byte("seed"))); err != nil {
+		t.Fatal(err)
+	}
+	if len(dbf.GetBitIndices()) != 0 {
+		t.Fatal("intersection with an empty dbf should be empty")
+	}
+}
+
+func TestEquals(t *testing.T) {
+	dbf1 := NewDbf(100, 0.1, []byte("seed"))
+	dbf2 := NewDbf(100, 0.1, []byte("seed"))
+	if !dbf1.Equals(dbf2) {
+		t.Fatal("empty dbfs with the same parameters should be equal")
+	}
+	dbf1.Add([]byte("something"))
+	if dbf1.Equals(dbf2) {
+		t.Fatal("dbfs with different bits should not be equal")
+	}
+	if NewDbf(100, 0.1, []byte("seed")).Equals(NewDbf(100, 0.1, []byte("other seed"))) {
+		t.Fatal("dbfs with different seeds should not be equal")
+	}
+	if NewDbf(100, 0.1, []byte("seed")).Equals(NewDbf(200, 0.1, []byte("seed"))) {
+		t.Fatal("dbfs with different parameters should not be equal")
+	}
+}
+
+func TestUnionCommutative(t *testing.T) {
+	a1 := NewDbf(100, 0.1, []byte("seed"))
+	b1 := NewDbf(100, 0.1, []byte("seed"))
+	a1.Add([]byte("something"))
+	b1.Add([]byte("something else"))
+	a2 := NewDbf(100, 0.1, []byte("seed"))
+	b2 := NewDbf(100, 0.1, []byte("seed"))
+	a2.Add([]byte("something"))
+	b2.Add([]byte("something else"))
+	if err := a1.Union(b1); err != nil {
+		t.Fatal(err)
+	}
+	if err := b2.Union(a2); err != nil {
+		t.Fatal(err)
+	}
+	if !a1.Equals(b2) {
+		t.Fatal("union should be commutative")
+	}
+}
+
+func TestDifference(t *testing.T) {
+	dbf1 := NewDbf(100, 0.1, []byte("seed"))
+	dbf2 := NewDbf(100, 0.1, []byte("seed"))
+	shared := []byte("shared")
+	element := []byte("something")
+	dbf1.Add(shared)
+	dbf1.Add(element)
+	dbf2.Add(shared)
+	count := dbf1.Count()
+	diff, err := dbf1.Difference(dbf2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff.Contains(shared) {
+		t.Fatal("difference should not contain the shared element")
+	}
+	if diff.b.IntersectionCardinality(dbf2.b) != 0 {
+		t.Fatal("difference should not have bits of the other dbf")
+	}
+	if dbf1.Count() != count {
+		t.Fatal("difference should not change the dbf")
+	}
+	if _, err := dbf1.Difference(NewDbf(100, 0.1, []byte("other seed"))); err == nil {
+		t.Fatal("difference of dbfs with different seeds should fail")
+	}
+}
+
+func TestMergeMany(t *testing.T) {
+	var filters []*DistBF
+	var elements [][]byte
+	for i := 0; i < 5; i++ {
+		dbf := NewDbf(100, 0.1, []byte("seed"))
+		element := []byte(fmt.Sprintf("element-%d", i))
+		dbf.Add(element)
+		filters = append(filters, dbf)
+		elements = append(elements, element)
+	}
+	merged, err := MergeMany(filters...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !merged.ContainsAll(elements) {
+		t.Fatal("merged dbf should contain the elements of all filters")
+	}
+	if filters[0].Contains(elements[1]) {
+		t.Fatal("merging should not change the filters")
+	}
+	single, err := MergeMany(filters[0])
+	if err != nil || !single.Equals(filters[0]) {
+		t.Fatal("merging a single filter should return a copy of it")
+	}
+	if _, err := MergeMany(); err == nil {
+		t.Fatal("merging no filters should fail")
+	}
+	_, err = MergeMany(filters[0], filters[1], NewDbf(100, 0.1, []byte("other seed")))
+	if err == nil {
+		t.Fatal("merging incompatible filters should fail")
+	}
+	assert.Contains(t, err.Error(), "filter 2")
+}
+
+func TestUnionPreview(t *testing.T) {
+	var filters []*DistBF
+	for i := 0; i < 5; i++ {
+		dbf := NewDbf(1000, 0.01, []byte("seed"))
+		dbf.AddBatch(batchElements(100 * (i + 1))[100*i:])
+		filters = append(filters, dbf)
+	}
+	count := filters[0].Count()
+	setBits, err := filters[0].UnionPreview(filters[1:]...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	merged, err := MergeMany(filters...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, merged.Count(), setBits)
+	assert.Equal(t, count, filters[0].Count(), "UnionPreview should not change the dbf")
+	alone, err := filters[0].UnionPreview()
+	if err != nil || alone != count {
+		t.Fatalf("the preview of no others should be the count of the dbf, got %d, %v", alone, err)
+	}
+	_, err = filters[0].UnionPreview(filters[1], NewDbf(1000, 0.01, []byte("other seed")))
+	if !errors.Is(err, ErrSeedMismatch) {
+		t.Fatalf("previewing an incompatible filter should fail with ErrSeedMismatch, got %v", err)
+	}
+	assert.Contains(t, err.Error(), "filter 2")
+}
+
+// TestOperationsProperties checks the set operations against reference maps of the added elements over
+// randomized sets: no added element of a result set may be reported missing
+func TestOperationsProperties(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	optionSets := [][]Option{
+		nil,
+		{WithPartitioning()},
+		{WithDomain([]byte("domain"))},
+	}
+	for round := 0; round < 50; round++ {
+		opts := append([]Option{WithSeed([]byte("seed"))}, optionSets[round%len(optionSets)]...)
+		n := uint(10 + r.Intn(500))
+		a, b := NewDbfWithOptions(n, 0.01, opts...), NewDbfWithOptions(n, 0.01, opts...)
+		inA, inB := make(map[string]bool), make(map[string]bool)
+		// draw from a shared universe so the sets overlap
+		universe := int(n) * 2
+		for i := r.Intn(int(n)); i > 0; i-- {
+			elem := fmt.Sprintf("element-%d", r.Intn(universe))
+			a.Add([]byte(elem))
+			inA[elem] = true
+		}
+		for i := r.Intn(int(n)); i > 0; i-- {
+			elem := fmt.Sprintf("element-%d", r.Intn(universe))
+			b.Add([]byte(elem))
+			inB[elem] = true
+		}
+
+		union := a.Clone()
+		if err := union.Union(b); err != nil {
+			t.Fatal(err)
+		}
+		merged, err := MergeMany(a, b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		orWords := a.Clone()
+		if err := orWords.OrWords(b.Words()); err != nil {
+			t.Fatal(err)
+		}
+		applied := a.Clone()
+		delta, err := b.DeltaFrom(a)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := applied.ApplyDelta(delta); err != nil {
+			t.Fatal(err)
+		}
+		intersection := a.Clone()
+		if err := intersection.Intersect(b); err != nil {
+			t.Fatal(err)
+		}
+		difference, err := a.Difference(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for elem := range inA {
+			for name, dbf := range map[string]*DistBF{"union": union, "merged": merged, "or words": orWords, "applied delta": applied} {
+				if !dbf.Contains([]byte(elem)) {
+					t.Fatalf("round %d: %s should contain %s of A", round, name, elem)
+				}
+			}
+			if inB[elem] && !intersection.Contains([]byte(elem)) {
+				t.Fatalf("round %d: intersection should contain %s of A and B", round, elem)
+			}
+		}
+		for elem := range inB {
+			for name, dbf := range map[string]*DistBF{"union": union, "merged": merged, "or words": orWords, "applied delta": applied} {
+				if !dbf.Contains([]byte(elem)) {
+					t.Fatalf("round %d: %s should contain %s of B", round, name, elem)
+				}
+			}
+		}
+		if !union.Equals(merged) || !union.Equals(orWords) || !union.Equals(applied) {
+			t.Fatalf("round %d: all unions should set the same bits", round)
+		}
+		// the difference can miss elements of A minus B, but it only keeps bits of A that are not in B
+		if difference.b.Difference(a.b).Any() || difference.b.IntersectionCardinality(b.b) != 0 {
+			t.Fatalf("round %d: difference should only keep bits of A that are not in B", round)
+		}
+	}
+}
+
+// TestOperationsBitwise checks the word-wise set operations against a bit by bit reference
+func TestOperationsBitwise(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	const m = 1000
+	a, b := NewDbfWithParams(m, 3, []byte("seed")), NewDbfWithParams(m, 3, []byte("seed"))
+	for i := uint(0); i < m; i++ {
+		if r.Intn(3) == 0 {
+			a.b.Set(i)
+		}
+		if r.Intn(3) == 0 {
+			b.b.Set(i)
+		}
+	}
+	union, intersection := a.Clone(), a.Clone()
+	if err := union.Union(b); err != nil {
+		t.Fatal(err)
+	}
+	if err := intersection.Intersect(b); err != nil {
+		t.Fatal(err)
+	}
+	difference, err := a.Difference(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := uint(0); i < m; i++ {
+		x, y := a.b.Test(i), b.b.Test(i)
+		if union.b.Test(i) != (x || y) || intersection.b.Test(i) != (x && y) || difference.b.Test(i) != (x && !y) {
+			t.Fatalf("bit %d of the set operations differs from the bitwise reference", i)
+		}
+	}
+	equal := a.Clone()
+	if !a.Equals(equal) {
+		t.Fatal("a clone should be equal")
+	}
+	for _, i := range []uint{0, 63, 64, m - 1} {
+		flipped := a.Clone()
+		flipped.b.Flip(i)
+		if a.Equals(flipped) {
+			t.Fatalf("dbfs differing in bit %d should not be equal", i)
+		}
+	}
+}
+
+func benchmarkLargePair(b *testing.B) (*DistBF, *DistBF) {
+	r := rand.New(rand.NewSource(1))
+	x, y := NewDbfWithParams(1e7, 7, []byte("seed")), NewDbfWithParams(1e7, 7, []byte("seed"))
+	for _, dbf := range []*DistBF{x, y} {
+		words := dbf.Words()
+		for i := range words {
+			words[i] = r.Uint64()
+		}
+		// no bits beyond m
+		words[len(words)-1] &= 1<<(10000000%64) - 1
+	}
+	b.SetBytes(int64(len(x.Words()) * 8))
+	b.ResetTimer()
+	return x, y
+}
+
+func BenchmarkUnion1e7(b *testing.B) {
+	x, y := benchmarkLargePair(b)
+	for i := 0; i < b.N; i++ {
+		x.Union(y)
+	}
+}
+
+func BenchmarkIntersect1e7(b *testing.B) {
+	x, y := benchmarkLargePair(b)
+	for i := 0; i < b.N; i++ {
+		x.Intersect(y)
+	}
+}
+
+func BenchmarkDifference1e7(b *testing.B) {
+	x, y := benchmarkLargePair(b)
+	for i := 0; i < b.N; i++ {
+		x.Difference(y)
+	}
+}
+
+func BenchmarkEquals1e7(b *testing.B) {
+	x, _ := benchmarkLargePair(b)
+	y := x.Clone()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		x.Equals(y)
+	}
+}
@@ -0,0 +1,190 @@
+package DBF
+
+import (
+	"crypto/hmac"
+	"crypto/sha512"
+	"errors"
+	"hash"
+	"sync"
+
+	"github.com/willf/bitset"
+)
+
+// Option configures a DBF created by NewDbfWithOptions
+type Option func(*DistBF)
+
+// WithSeed sets the seed value that determines the bloom filter mapping
+func WithSeed(s []byte) Option {
+	return func(dbf *DistBF) {
+		dbf.s = append([]byte(nil), s...)
+	}
+}
+
+// WithHash sets the hash function used for the seed and element hashes, SHA-512/256 by default
+func WithHash(hf func() hash.Hash) Option {
+	return func(dbf *DistBF) {
+		dbf.hf = hf
+	}
+}
+
+// WithKeyedHash hashes seeds and elements with HMAC-SHA-512/256 under key instead of plain SHA-512/256.
+// An attacker who can choose the elements but does not know the key cannot predict their indices, so
+// they cannot craft elements that all map to a few bits to saturate the DBF or to force false positives.
+// The key must stay secret and be shared by all peers, anyone with the key can craft such elements.
+func WithKeyedHash(key []byte) Option {
+	key = append([]byte(nil), key...)
+	return WithHash(func() hash.Hash {
+		return hmac.New(sha512.New512_256, key)
+	})
+}
+
+// WithEstimatedParameters overrides the m and k estimated from n and fpr
+func WithEstimatedParameters(m, k uint) Option {
+	return func(dbf *DistBF) {
+		dbf.m = m
+		dbf.k = k
+	}
+}
+
+// WithPartitioning splits the m bits into k partitions of m/k bits, with hash j setting one bit in partition j.
+// An m below k, as WithEstimatedParameters can set, is raised to k so every partition has a bit.
+func WithPartitioning() Option {
+	return func(dbf *DistBF) {
+		dbf.partitioned = true
+	}
+}
+
+// WithDomain mixes a domain tag into the seed hashes, so DBFs with the same seed but different domains map
+// elements independently. Peers must agree on the domain as well as the seed.
+func WithDomain(tag []byte) Option {
+	return func(dbf *DistBF) {
+		dbf.domain = append([]byte(nil), tag...)
+	}
+}
+
+// WithLittleEndianIndices reads the digest bytes an index is reduced from little endian. By default they are
+// read big endian, peers must agree on the byte order or their indices do not match.
+func WithLittleEndianIndices() Option {
+	return func(dbf *DistBF) {
+		dbf.littleEndian = true
+	}
+}
+
+// WithMaxFillRatio makes AddChecked fail with ErrFilterFull once the fill ratio reaches ratio, in (0, 1].
+// Add is not limited.
+func WithMaxFillRatio(ratio float64) Option {
+	return func(dbf *DistBF) {
+		dbf.maxFill = ratio
+	}
+}
+
+// WithLazySeedHashes computes the k seed hashes on the first Add or Contains instead of at construction and
+// whenever the seed or k change, which saves the work for DBFs that are decoded into right away.
+// It is safe under ConcurrentDistBF and AtomicDistBF.
+func WithLazySeedHashes() Option {
+	return func(dbf *DistBF) {
+		dbf.lazy = new(sync.Once)
+	}
+}
+
+// WithIndexCache keeps the indices of the size most recently added or queried elements, keyed by their hash,
+// so repeated elements skip computing them. The cache does not change any result.
+func WithIndexCache(size int) Option {
+	return func(dbf *DistBF) {
+		if size > 0 {
+			dbf.cache = newIndexCache(size)
+		}
+	}
+}
+
+// WithSummary keeps a summary bit array of the given size with one bit per added element, which Contains checks
+// before the k indices, so most elements that were not added are rejected without computing their indices.
+// A fraction of about 1-exp(-n/bits) of them still passes to the full check, so bits should be several times
+// the number of elements n to pay off. It never causes false negatives, and is dropped when bits are set
+// without their elements, see SetIndices, Union and the decoders, until the DBF is cleared.
+func WithSummary(bits uint) Option {
+	return func(dbf *DistBF) {
+		dbf.summaryBits = bits
+	}
+}
+
+// Params are the parameters and mapping options two DBFs must share to be compatible, for peers to agree on
+// before building their DBFs. Hash is not serialized, peers that do not use SHA-512/256 must agree on it
+// separately and set it on both sides.
+type Params struct {
+	M            uint             `json:"m"`
+	K            uint             `json:"k"`
+	Seed         []byte           `json:"seed"`
+	Partitioned  bool             `json:"partitioned,omitempty"`
+	Domain       []byte           `json:"domain,omitempty"`
+	LittleEndian bool             `json:"little_endian,omitempty"`
+	Hash         func() hash.Hash `json:"-"`
+}
+
+// Params returns the parameters of DBF, NewDbfFromParams builds an empty DBF compatible with it from them
+func (dbf *DistBF) Params() Params {
+	return Params{
+		M:            dbf.m,
+		K:            dbf.k,
+		Seed:         append([]byte(nil), dbf.s...),
+		Partitioned:  dbf.partitioned,
+		Domain:       append([]byte(nil), dbf.domain...),
+		LittleEndian: dbf.littleEndian,
+		Hash:         dbf.hf,
+	}
+}
+
+// NewDbfFromParams returns the empty DBF with the parameters p, or an error if M or K is 0 or a partitioned
+// DBF has fewer bits than hashes
+func NewDbfFromParams(p Params) (*DistBF, error) {
+	if p.M == 0 || p.K == 0 {
+		return nil, errors.New("DBF: m and k must be greater than 0")
+	}
+	if p.Partitioned && p.M < p.K {
+		return nil, errors.New("DBF: a partitioned filter needs m of at least k")
+	}
+	opts := []Option{WithSeed(p.Seed)}
+	if p.Hash != nil {
+		opts = append(opts, WithHash(p.Hash))
+	}
+	if p.Partitioned {
+		opts = append(opts, WithPartitioning())
+	}
+	if len(p.Domain) != 0 {
+		opts = append(opts, WithDomain(p.Domain))
+	}
+	if p.LittleEndian {
+		opts = append(opts, WithLittleEndianIndices())
+	}
+	return newDbf(p.M, p.K, opts), nil
+}
+
+// NewDbfWithOptions returns the DBF sized for n elements at the false positive rate fpr, configured by opts
+func NewDbfWithOptions(n uint, fpr float64, opts ...Option) *DistBF {
+	m, k := EstimateParameters(n, fpr)
+	dbf := newDbf(m, k, opts)
+	dbf.n = n
+	dbf.fpr = fpr
+	return dbf
+}
+
+// newDbf returns the DBF with m bits and k hashes, configured by opts
+func newDbf(m, k uint, opts []Option) *DistBF {
+	dbf := &DistBF{m: m, k: k}
+	for _, opt := range opts {
+		opt(dbf)
+	}
+	dbf.clampPartitions()
+	dbf.resetSeedHashes()
+	dbf.b = bitset.New(dbf.m)
+	dbf.resetSummary()
+	return dbf
+}
+
+// clampPartitions raises the m of a partitioned DBF to k if it is smaller, since m/k bit partitions would
+// be empty
+func (dbf *DistBF) clampPartitions() {
+	if dbf.partitioned && dbf.m < dbf.k {
+		dbf.m = dbf.k
+	}
+}
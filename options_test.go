@@ -0,0 +1,301 @@
+package DBF
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestNewDbfWithOptions(t *testing.T) {
+	seed := []byte("seed")
+	if !NewDbfWithOptions(100, 0.1, WithSeed(seed)).Equals(NewDbf(100, 0.1, seed)) {
+		t.Fatal("NewDbf should be equal to NewDbfWithOptions with the same seed")
+	}
+	dbf := NewDbfWithOptions(100, 0.1, WithSeed(seed), WithHash(sha256.New), WithEstimatedParameters(64, 3))
+	if dbf.m != 64 || dbf.k != 3 || len(dbf.h) != 3 {
+		t.Fatal("explicit parameters should override the estimated ones")
+	}
+	if len(dbf.h[0]) != sha256.Size {
+		t.Fatal("seed hashes should be computed with the configured hash")
+	}
+	element := []byte("something")
+	dbf.Add(element)
+	if !dbf.Contains(element) {
+		t.Fatal("added element should be contained in dbf")
+	}
+}
+
+func TestWithPartitioning(t *testing.T) {
+	dbf := NewDbfWithOptions(100, 0.1, WithSeed([]byte("seed")), WithPartitioning())
+	p := dbf.m / dbf.k
+	for i := 0; i < 100; i++ {
+		element := []byte(randStringBytes(8))
+		indices := dbf.GetElementIndices(element)
+		if len(indices) != int(dbf.k) {
+			t.Fatal("there must be k indices")
+		}
+		for j, index := range indices {
+			if index < uint(j)*p || index >= uint(j+1)*p {
+				t.Fatalf("index %d of hash %d is outside of its partition", index, j)
+			}
+		}
+		dbf.Add(element)
+		if !dbf.Contains(element) {
+			t.Fatal("added element should be contained in dbf")
+		}
+	}
+	if err := dbf.Union(NewDbf(100, 0.1, []byte("seed"))); err == nil {
+		t.Fatal("union of partitioned and unpartitioned dbfs should fail")
+	}
+	small := NewDbfWithOptions(100, 0.1, WithSeed([]byte("seed")), WithEstimatedParameters(3, 5), WithPartitioning())
+	if small.m != 5 {
+		t.Fatalf("m below k should be raised to k=5, got %d", small.m)
+	}
+	small.Add([]byte("something"))
+	if !small.Contains([]byte("something")) {
+		t.Fatal("added element should be contained in dbf")
+	}
+}
+
+func TestWithDomain(t *testing.T) {
+	emails := NewDbfWithOptions(100, 0.1, WithSeed([]byte("seed")), WithDomain([]byte("emails")))
+	phones := NewDbfWithOptions(100, 0.1, WithSeed([]byte("seed")), WithDomain([]byte("phones")))
+	plain := NewDbf(100, 0.1, []byte("seed"))
+	element := []byte("something")
+	if reflect.DeepEqual(emails.GetElementIndices(element), phones.GetElementIndices(element)) ||
+		reflect.DeepEqual(emails.GetElementIndices(element), plain.GetElementIndices(element)) {
+		t.Fatal("dbfs with different domains should map elements to different indices")
+	}
+	if err := emails.Union(phones); err == nil {
+		t.Fatal("union of dbfs with different domains should fail")
+	}
+	emails.Add(element)
+	if !emails.Contains(element) {
+		t.Fatal("added element should be contained in dbf")
+	}
+}
+
+func TestWithKeyedHash(t *testing.T) {
+	dbf1 := NewDbfWithOptions(100, 0.1, WithSeed([]byte("seed")), WithKeyedHash([]byte("key")))
+	dbf2 := NewDbfWithOptions(100, 0.1, WithSeed([]byte("seed")), WithKeyedHash([]byte("other key")))
+	plain := NewDbf(100, 0.1, []byte("seed"))
+	element := []byte("something")
+	if reflect.DeepEqual(dbf1.GetElementIndices(element), dbf2.GetElementIndices(element)) ||
+		reflect.DeepEqual(dbf1.GetElementIndices(element), plain.GetElementIndices(element)) {
+		t.Fatal("dbfs with different keys should map elements to different indices")
+	}
+	same := NewDbfWithOptions(100, 0.1, WithSeed([]byte("seed")), WithKeyedHash([]byte("key")))
+	if !reflect.DeepEqual(dbf1.GetElementIndices(element), same.GetElementIndices(element)) {
+		t.Fatal("dbfs with the same key should map elements to the same indices")
+	}
+	if err := dbf1.Union(dbf2); err == nil {
+		t.Fatal("union of dbfs with different keys should fail")
+	}
+}
+
+func TestWithLittleEndianIndices(t *testing.T) {
+	big := NewDbf(1000, 0.01, []byte("seed"))
+	little := NewDbfWithOptions(1000, 0.01, WithSeed([]byte("seed")), WithLittleEndianIndices())
+	element := []byte("something")
+	if reflect.DeepEqual(big.GetElementIndices(element), little.GetElementIndices(element)) {
+		t.Fatal("big and little endian dbfs should map elements to different indices")
+	}
+	if err := big.Union(little); err == nil {
+		t.Fatal("union of dbfs with different byte orders should fail")
+	}
+	little.Add(element)
+	if !little.Contains(element) {
+		t.Fatal("added element should be contained in dbf")
+	}
+	if uintFromBytesLittleEndian([]byte{1, 2}) != 0x0201 || uintFromBytes([]byte{1, 2}) != 0x0102 {
+		t.Fatal("short digests should be read in the configured byte order")
+	}
+}
+
+func BenchmarkAddSmallM(b *testing.B) {
+	dbf := NewDbf(100, 0.01, []byte("seed"))
+	elem := []byte("something")
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		dbf.Add(elem)
+	}
+}
+
+func TestWithMaxFillRatio(t *testing.T) {
+	dbf := NewDbfWithOptions(100, 0.1, WithSeed([]byte("seed")), WithMaxFillRatio(0.5))
+	var err error
+	added := 0
+	for ; err == nil && added < 1000; added++ {
+		err = dbf.AddChecked([]byte(fmt.Sprintf("element-%d", added)))
+	}
+	if err != ErrFilterFull {
+		t.Fatalf("AddChecked should fail with ErrFilterFull, got %v", err)
+	}
+	if dbf.FillRatio() < 0.5 {
+		t.Fatalf("AddChecked failed at fill ratio %f below the limit", dbf.FillRatio())
+	}
+	count := dbf.Count()
+	if dbf.AddChecked([]byte("another")) != ErrFilterFull || dbf.Count() != count {
+		t.Fatal("AddChecked on a full dbf should not change it")
+	}
+	dbf.Add([]byte("another"))
+	if !dbf.Contains([]byte("another")) {
+		t.Fatal("Add should not be limited")
+	}
+	unlimited := NewDbf(10, 0.1, []byte("seed"))
+	for i := 0; i < 1000; i++ {
+		if err := unlimited.AddChecked([]byte(fmt.Sprintf("element-%d", i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestWithMaxFillRatioTracksSetBits(t *testing.T) {
+	newDbf := func() *DistBF {
+		return NewDbfWithOptions(100, 0.1, WithSeed([]byte("seed")), WithMaxFillRatio(0.5))
+	}
+	full := newDbf()
+	full.AddBatch(batchElements(1000))
+	// every way of changing bits after the count of AddChecked must keep it or make AddChecked count again
+	changes := map[string]func(dbf *DistBF) error{
+		"Add":      func(dbf *DistBF) error { dbf.Add([]byte("added")); return nil },
+		"AddBatch": func(dbf *DistBF) error { dbf.AddBatch(batchElements(1000)); return nil },
+		"AddString": func(dbf *DistBF) error {
+			for _, elem := range batchElements(1000) {
+				dbf.AddString(string(elem))
+			}
+			return nil
+		},
+		"AddReader":  func(dbf *DistBF) error { return dbf.AddReader(bytes.NewReader([]byte("added"))) },
+		"Union":      func(dbf *DistBF) error { return dbf.Union(full) },
+		"Intersect":  func(dbf *DistBF) error { return dbf.Intersect(newDbf()) },
+		"SetIndices": func(dbf *DistBF) error { dbf.SetIndices([]int{0, 1, 2}); return nil },
+		"BitArray":   func(dbf *DistBF) error { dbf.BitArray().Set(5); return nil },
+		"Clear":      func(dbf *DistBF) error { dbf.Clear(); return nil },
+		"GrowBy": func(dbf *DistBF) error {
+			grown, err := dbf.GrowBy(2)
+			*dbf = *grown
+			return err
+		},
+	}
+	for name, change := range changes {
+		dbf := newDbf()
+		if err := dbf.AddChecked([]byte("something")); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if err := change(dbf); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		fill := dbf.FillRatio()
+		if err := dbf.AddChecked([]byte("something else")); (fill >= 0.5) != (err == ErrFilterFull) {
+			t.Fatalf("%s: AddChecked returned %v at fill ratio %f", name, err, fill)
+		}
+		if dbf.setBitsKnown && dbf.setBits != dbf.Count() {
+			t.Fatalf("%s: tracked %d set bits, counted %d", name, dbf.setBits, dbf.Count())
+		}
+	}
+}
+
+func BenchmarkAddChecked(b *testing.B) {
+	dbf := NewDbfWithOptions(1000000, 0.01, WithSeed([]byte("seed")), WithMaxFillRatio(0.9))
+	elements := batchElements(1000)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		dbf.AddChecked(elements[i%len(elements)])
+	}
+}
+
+func TestWithLazySeedHashes(t *testing.T) {
+	eager := NewDbf(1000, 0.01, []byte("seed"))
+	lazy := NewDbfWithOptions(1000, 0.01, WithSeed([]byte("seed")), WithLazySeedHashes())
+	if lazy.h != nil {
+		t.Fatal("lazy seed hashes should not be computed at construction")
+	}
+	for _, elem := range batchElements(100) {
+		if !reflect.DeepEqual(eager.GetElementIndices(elem), lazy.GetElementIndices(elem)) {
+			t.Fatal("lazy and eager seed hashes should map elements to the same indices")
+		}
+	}
+	if !reflect.DeepEqual(eager.h, lazy.h) {
+		t.Fatal("lazy seed hashes should equal the eager ones once computed")
+	}
+
+	data, err := eager.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded := NewDbfWithOptions(10, 0.1, WithSeed([]byte("other")), WithLazySeedHashes())
+	decoded.GetElementIndices([]byte("something"))
+	if err := decoded.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.h != nil {
+		t.Fatal("decoding should reset lazy seed hashes")
+	}
+	if !decoded.Equals(eager) {
+		t.Fatal("decoded lazy dbf should equal the original dbf")
+	}
+	if !reflect.DeepEqual(eager.GetElementIndices([]byte("something")), decoded.GetElementIndices([]byte("something"))) {
+		t.Fatal("decoded lazy dbf should map elements like the original dbf")
+	}
+
+	// run with -race to detect unsynchronized initialization
+	concurrent := NewAtomicDbf(NewDbfWithOptions(1000, 0.01, WithSeed([]byte("seed")), WithLazySeedHashes()))
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			concurrent.Add([]byte("something"))
+		}()
+	}
+	wg.Wait()
+	if !concurrent.Contains([]byte("something")) || !eager.Compatible(concurrent.dbf) {
+		t.Fatal("lazily initialized dbf should map like an eager one")
+	}
+}
+
+func TestParams(t *testing.T) {
+	dbf := NewDbfWithOptions(1000, 0.01, WithSeed([]byte("seed")), WithPartitioning(), WithDomain([]byte("domain")))
+	dbf.Add([]byte("something"))
+	data, err := json.Marshal(dbf.Params())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var p Params
+	if err := json.Unmarshal(data, &p); err != nil {
+		t.Fatal(err)
+	}
+	peer1, err := NewDbfFromParams(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	peer2, err := NewDbfFromParams(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !peer1.Compatible(peer2) || !peer1.Compatible(dbf) {
+		t.Fatal("dbfs built from the same params should be compatible")
+	}
+	if peer1.Count() != 0 {
+		t.Fatal("dbf built from params should be empty")
+	}
+	keyed := NewDbfWithOptions(1000, 0.01, WithSeed([]byte("seed")), WithKeyedHash([]byte("key")))
+	fromKeyed, err := NewDbfFromParams(keyed.Params())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !fromKeyed.Compatible(keyed) {
+		t.Fatal("params should carry the hash function")
+	}
+	for _, invalid := range []Params{{M: 0, K: 1}, {M: 10, K: 0}, {M: 2, K: 3, Partitioned: true}} {
+		if _, err := NewDbfFromParams(invalid); err == nil {
+			t.Fatalf("params %+v should fail", invalid)
+		}
+	}
+}
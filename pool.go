@@ -0,0 +1,57 @@
+package DBF
+
+import (
+	"sync"
+)
+
+// DbfPool reuses DBFs of the same parameters through a sync.Pool, saving the allocation of the bit array
+// and the computation of the seed hashes for every new DBF
+type DbfPool struct {
+	pool sync.Pool
+	// template is a DBF created like those of the pool and never handed out, Put compares against it
+	template *DistBF
+}
+
+// NewDbfPool returns the pool of DBFs created like NewDbfWithOptions(n, fpr, opts...)
+func NewDbfPool(n uint, fpr float64, opts ...Option) *DbfPool {
+	p := &DbfPool{template: NewDbfWithOptions(n, fpr, opts...)}
+	p.pool.New = func() interface{} {
+		return NewDbfWithOptions(n, fpr, opts...)
+	}
+	return p
+}
+
+// Get returns an empty DBF with the parameters of the pool
+func (p *DbfPool) Get() *DistBF {
+	return p.pool.Get().(*DistBF)
+}
+
+// Put clears dbf, along with its stats, audit log, summary and index cache, and returns it to the pool, it must
+// not be used afterwards. DBFs that are not Compatible with those of the pool, like ones another filter was
+// decoded into, or that were created with other options are dropped.
+func (p *DbfPool) Put(dbf *DistBF) {
+	if !p.template.Compatible(dbf) || !p.sameOptions(dbf) {
+		return
+	}
+	dbf.frozen = false
+	dbf.Clear()
+	if dbf.stats != nil {
+		dbf.stats = new(statsCounters)
+	}
+	if dbf.cache != nil {
+		dbf.cache = dbf.cache.empty()
+	}
+	p.pool.Put(dbf)
+}
+
+// sameOptions returns true if dbf has the design intent and the options of the pool that Compatible does
+// not compare
+func (p *DbfPool) sameOptions(dbf *DistBF) bool {
+	t := p.template
+	return t.n == dbf.n && t.fpr == dbf.fpr && t.maxFill == dbf.maxFill && t.summaryBits == dbf.summaryBits &&
+		(t.stats == nil) == (dbf.stats == nil) &&
+		(t.audit == nil) == (dbf.audit == nil) &&
+		(t.lazy == nil) == (dbf.lazy == nil) &&
+		(t.cache == nil) == (dbf.cache == nil) &&
+		(t.cache == nil || t.cache.size == dbf.cache.size)
+}
@@ -0,0 +1,103 @@
+package DBF
+
+import (
+	"testing"
+)
+
+func TestDbfPool(t *testing.T) {
+	p := NewDbfPool(1000, 0.01, WithSeed([]byte("seed")))
+	fresh := NewDbf(1000, 0.01, []byte("seed"))
+	for i := 0; i < 10; i++ {
+		dbf := p.Get()
+		if !dbf.Equals(fresh) {
+			t.Fatal("pooled dbf should be empty and have the parameters of the pool")
+		}
+		dbf.AddBatch(batchElements(100))
+		if i%2 == 0 {
+			dbf.Freeze()
+		}
+		p.Put(dbf)
+	}
+	p.Put(NewDbf(10, 0.1, []byte("seed")))
+	p.Put(NewDbf(1000, 0.01, []byte("other seed")))
+	p.Put(NewDbfWithOptions(1000, 0.01, WithSeed([]byte("seed")), WithDomain([]byte("domain"))))
+	peer := NewDbfWithOptions(1000, 0.01, WithSeed([]byte("peer seed")))
+	data, err := peer.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded := p.Get()
+	if err := decoded.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	p.Put(decoded)
+	for i := 0; i < 10; i++ {
+		if dbf := p.Get(); !dbf.Equals(fresh) || dbf.Frozen() {
+			t.Fatal("pool should drop dbfs that are not compatible with its own")
+		}
+	}
+}
+
+func TestDbfPoolResetsState(t *testing.T) {
+	opts := []Option{WithSeed([]byte("seed")), WithStats(), WithAudit(), WithSummary(8000), WithIndexCache(10),
+		WithMaxFillRatio(0.9)}
+	p := NewDbfPool(1000, 0.01, opts...)
+	dbf := p.Get()
+	element := []byte("something")
+	if err := dbf.AddChecked(element); err != nil {
+		t.Fatal(err)
+	}
+	dbf.Contains(element)
+	p.Put(dbf)
+	got := p.Get()
+	if got != dbf {
+		// sync.Pool may drop the put DBF, nothing to check then
+		t.Skip("pool did not return the put dbf")
+	}
+	stats := got.Stats()
+	if stats.Adds != 0 || stats.Queries != 0 || stats.SetBits != 0 {
+		t.Fatalf("pooled dbf should have zeroed stats, got %+v", stats)
+	}
+	if len(got.AuditLog()) != 0 || got.summary == nil || got.summary.Any() || got.cache.order.Len() != 0 {
+		t.Fatal("pooled dbf should have an empty audit log, summary and index cache")
+	}
+	if got.setBitsKnown {
+		t.Fatal("pooled dbf should count its set bits again")
+	}
+	p.Put(got)
+
+	others := map[string][]Option{
+		"no stats":       {WithSeed([]byte("seed")), WithAudit(), WithSummary(8000), WithIndexCache(10), WithMaxFillRatio(0.9)},
+		"no audit":       {WithSeed([]byte("seed")), WithStats(), WithSummary(8000), WithIndexCache(10), WithMaxFillRatio(0.9)},
+		"other summary":  {WithSeed([]byte("seed")), WithStats(), WithAudit(), WithSummary(16), WithIndexCache(10), WithMaxFillRatio(0.9)},
+		"other cache":    {WithSeed([]byte("seed")), WithStats(), WithAudit(), WithSummary(8000), WithIndexCache(20), WithMaxFillRatio(0.9)},
+		"other max fill": {WithSeed([]byte("seed")), WithStats(), WithAudit(), WithSummary(8000), WithIndexCache(10)},
+	}
+	for name, opts := range others {
+		other := NewDbfWithOptions(1000, 0.01, opts...)
+		p.Put(other)
+		for i := 0; i < 10; i++ {
+			if p.Get() == other {
+				t.Fatalf("%s: pool should drop dbfs with other options", name)
+			}
+		}
+	}
+}
+
+func BenchmarkNewDbf(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		dbf := NewDbf(10000, 0.01, []byte("seed"))
+		dbf.Add([]byte("something"))
+	}
+}
+
+func BenchmarkDbfPool(b *testing.B) {
+	p := NewDbfPool(10000, 0.01, WithSeed([]byte("seed")))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		dbf := p.Get()
+		dbf.Add([]byte("something"))
+		p.Put(dbf)
+	}
+}
@@ -0,0 +1,15 @@
+package DBF
+
+import "math/rand"
+
+// RandomElements returns n random elements of length bytes each drawn from rng, so load generated with
+// the same seeded rng is reproducible
+func RandomElements(n, length int, rng *rand.Rand) [][]byte {
+	data := make([]byte, n*length)
+	rng.Read(data)
+	elements := make([][]byte, n)
+	for i := range elements {
+		elements[i] = data[i*length : (i+1)*length : (i+1)*length]
+	}
+	return elements
+}
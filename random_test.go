@@ -0,0 +1,30 @@
+package DBF
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+func TestRandomElements(t *testing.T) {
+	elements := RandomElements(100, 8, rand.New(rand.NewSource(1)))
+	if len(elements) != 100 {
+		t.Fatalf("got %d elements, want 100", len(elements))
+	}
+	for _, elem := range elements {
+		if len(elem) != 8 {
+			t.Fatalf("got an element of %d bytes, want 8", len(elem))
+		}
+	}
+	if !reflect.DeepEqual(elements, RandomElements(100, 8, rand.New(rand.NewSource(1)))) {
+		t.Fatal("the same rng seed should produce the same elements")
+	}
+	if reflect.DeepEqual(elements, RandomElements(100, 8, rand.New(rand.NewSource(2)))) {
+		t.Fatal("different rng seeds should produce different elements")
+	}
+	next := append([]byte(nil), elements[1]...)
+	elements[0] = append(elements[0], 0xff)
+	if !reflect.DeepEqual(elements[1], next) {
+		t.Fatal("appending to an element should not change the next one")
+	}
+}
@@ -0,0 +1,93 @@
+package DBF
+
+import (
+	"time"
+)
+
+// RotatingDistBF approximates the elements seen recently by keeping several generations of DBFs. Add writes
+// to the newest generation and Contains checks all of them. Once the newest generation holds its n elements,
+// or is older than the rotation period if one is set, a new generation starts and the oldest one is dropped,
+// so an element is forgotten after as many rotations as there are generations. It is not safe for
+// concurrent use.
+type RotatingDistBF struct {
+	generations []*DistBF
+	size        int
+	n           uint
+	added       uint
+	period      time.Duration
+	started     time.Time
+	now         func() time.Time
+}
+
+// NewRotatingDbf returns the rotating DBF of up to generations DBFs that each hold n elements at the false
+// positive rate fpr, rotating when the newest one is full. It panics if generations is not positive.
+func NewRotatingDbf(n uint, fpr float64, s []byte, generations int) *RotatingDistBF {
+	return NewRotatingDbfWithPeriod(n, fpr, s, generations, 0)
+}
+
+// NewRotatingDbfWithPeriod returns the rotating DBF like NewRotatingDbf that also rotates when the newest
+// generation is older than period, checked on Add and Contains. A period of 0 only rotates by count.
+func NewRotatingDbfWithPeriod(n uint, fpr float64, s []byte, generations int, period time.Duration) *RotatingDistBF {
+	if generations <= 0 {
+		panic("DBF: generations must be greater than 0")
+	}
+	r := &RotatingDistBF{
+		generations: []*DistBF{NewDbf(n, fpr, s)},
+		size:        generations,
+		n:           n,
+		period:      period,
+		now:         time.Now,
+	}
+	r.started = r.now()
+	return r
+}
+
+// Rotate starts a new generation, dropping the oldest one if all generations are in use
+func (r *RotatingDistBF) Rotate() {
+	var next *DistBF
+	if len(r.generations) == r.size {
+		// reuse the bit array of the dropped generation
+		next = r.generations[0]
+		next.Clear()
+		r.generations = append(r.generations[:0], r.generations[1:]...)
+	} else {
+		next = r.generations[0].Clone()
+		next.Clear()
+	}
+	r.generations = append(r.generations, next)
+	r.added = 0
+	r.started = r.now()
+}
+
+// rotateIfDue rotates if the newest generation is full or older than the period
+func (r *RotatingDistBF) rotateIfDue() {
+	if r.added >= r.n || (r.period > 0 && r.now().Sub(r.started) >= r.period) {
+		r.Rotate()
+	}
+}
+
+// Add element to the newest generation, rotating first if it is due
+func (r *RotatingDistBF) Add(element []byte) {
+	r.rotateIfDue()
+	r.generations[len(r.generations)-1].Add(element)
+	r.added++
+}
+
+// Contains returns true if element is probably in one of the generations, false if it is definitely not
+// or was forgotten
+func (r *RotatingDistBF) Contains(element []byte) bool {
+	if r.period > 0 {
+		r.rotateIfDue()
+	}
+	for _, dbf := range r.generations {
+		if dbf.Contains(element) {
+			return true
+		}
+	}
+	return false
+}
+
+// Generations returns the number of active generations
+func (r *RotatingDistBF) Generations() int {
+	return len(r.generations)
+}
@@ -0,0 +1,62 @@
+package DBF
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRotatingDistBF(t *testing.T) {
+	r := NewRotatingDbf(100, 0.001, []byte("seed"), 3)
+	for i := 0; i < 100; i++ {
+		r.Add([]byte(fmt.Sprintf("old-%d", i)))
+	}
+	assert.Equal(t, 1, r.Generations())
+	// two more generations keep the old elements
+	for i := 0; i < 200; i++ {
+		r.Add([]byte(fmt.Sprintf("new-%d", i)))
+	}
+	assert.Equal(t, 3, r.Generations())
+	for i := 0; i < 100; i++ {
+		if !r.Contains([]byte(fmt.Sprintf("old-%d", i))) {
+			t.Fatal("elements of an active generation should be contained")
+		}
+	}
+	// the next rotation drops the generation of the old elements
+	r.Add([]byte("newest"))
+	assert.Equal(t, 3, r.Generations())
+	forgotten := 0
+	for i := 0; i < 100; i++ {
+		if !r.Contains([]byte(fmt.Sprintf("old-%d", i))) {
+			forgotten++
+		}
+	}
+	if forgotten < 95 {
+		t.Fatalf("only %d of 100 old elements were forgotten", forgotten)
+	}
+	for i := 100; i < 200; i++ {
+		if !r.Contains([]byte(fmt.Sprintf("new-%d", i))) {
+			t.Fatal("elements of an active generation should be contained")
+		}
+	}
+	assert.Panics(t, func() { NewRotatingDbf(100, 0.01, []byte("seed"), 0) })
+}
+
+func TestRotatingDistBFPeriod(t *testing.T) {
+	now := time.Unix(0, 0)
+	r := NewRotatingDbfWithPeriod(1000, 0.001, []byte("seed"), 2, time.Minute)
+	r.now = func() time.Time { return now }
+	r.started = now
+	r.Add([]byte("something"))
+	now = now.Add(time.Minute)
+	if !r.Contains([]byte("something")) {
+		t.Fatal("element of the previous generation should be contained")
+	}
+	assert.Equal(t, 2, r.Generations())
+	now = now.Add(time.Minute)
+	if r.Contains([]byte("something")) {
+		t.Fatal("element should be forgotten after two periods")
+	}
+}
@@ -0,0 +1,80 @@
+package DBF
+
+import (
+	"math"
+)
+
+// ScalableDistBF grows by appending larger DBFs once the newest one reaches its false positive rate,
+// following the scalable bloom filter of Almeida et al. The ith DBF is sized for n*growth^i elements at
+// fpr*(1-tightening)*tightening^i, which keeps the compound false positive rate below fpr.
+type ScalableDistBF struct {
+	filters    []*DistBF
+	fprs       []float64
+	setBits    uint
+	n          uint
+	fpr        float64
+	growth     float64
+	tightening float64
+	s          []byte
+}
+
+// NewScalableDbf returns the scalable DBF starting at n elements with a growth of 2 and a tightening of 0.9
+func NewScalableDbf(n uint, fpr float64, s []byte) *ScalableDistBF {
+	return NewScalableDbfWithRatios(n, fpr, s, 2, 0.9)
+}
+
+// NewScalableDbfWithRatios returns the scalable DBF starting at n elements, each new DBF holds growth times
+// the elements of the previous one at tightening times its false positive rate
+func NewScalableDbfWithRatios(n uint, fpr float64, s []byte, growth, tightening float64) *ScalableDistBF {
+	sdbf := &ScalableDistBF{
+		n:          n,
+		fpr:        fpr,
+		growth:     growth,
+		tightening: tightening,
+		s:          append([]byte(nil), s...),
+	}
+	sdbf.grow()
+	return sdbf
+}
+
+// grow appends the next DBF
+func (sdbf *ScalableDistBF) grow() {
+	i := float64(len(sdbf.filters))
+	n := uint(math.Ceil(float64(sdbf.n) * math.Pow(sdbf.growth, i)))
+	fpr := sdbf.fpr * (1 - sdbf.tightening) * math.Pow(sdbf.tightening, i)
+	sdbf.filters = append(sdbf.filters, NewDbf(n, fpr, sdbf.s))
+	sdbf.fprs = append(sdbf.fprs, fpr)
+	sdbf.setBits = 0
+}
+
+// Add element to the newest DBF, growing first if it reached its false positive rate
+func (sdbf *ScalableDistBF) Add(element []byte) {
+	last := len(sdbf.filters) - 1
+	dbf := sdbf.filters[last]
+	if math.Pow(float64(sdbf.setBits)/float64(dbf.m), float64(dbf.k)) >= sdbf.fprs[last] {
+		sdbf.grow()
+		dbf = sdbf.filters[last+1]
+	}
+	// count the newly set bits to track the false positive rate without a popcount per Add
+	for _, location := range dbf.GetElementIndices(element) {
+		if !dbf.b.Test(location) {
+			dbf.b.Set(location)
+			sdbf.setBits++
+		}
+	}
+}
+
+// Contains returns true if element is probably in one of the DBFs, false if it is definitely not
+func (sdbf *ScalableDistBF) Contains(element []byte) bool {
+	for _, dbf := range sdbf.filters {
+		if dbf.Contains(element) {
+			return true
+		}
+	}
+	return false
+}
+
+// Filters returns the number of DBFs
+func (sdbf *ScalableDistBF) Filters() int {
+	return len(sdbf.filters)
+}
@@ -0,0 +1,31 @@
+package DBF
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestScalableDistBF(t *testing.T) {
+	n, fpr := uint(100), 0.01
+	sdbf := NewScalableDbf(n, fpr, []byte("seed"))
+	for i := 0; i < 20*int(n); i++ {
+		sdbf.Add([]byte(fmt.Sprintf("element-%d", i)))
+	}
+	if sdbf.Filters() < 2 {
+		t.Fatal("scalable dbf should grow beyond its initial capacity")
+	}
+	for i := 0; i < 20*int(n); i++ {
+		if !sdbf.Contains([]byte(fmt.Sprintf("element-%d", i))) {
+			t.Fatal("added element should be contained in scalable dbf")
+		}
+	}
+	probes, falsePositives := 10000, 0
+	for i := 0; i < probes; i++ {
+		if sdbf.Contains([]byte(fmt.Sprintf("other-%d", i))) {
+			falsePositives++
+		}
+	}
+	if observed := float64(falsePositives) / float64(probes); observed > fpr {
+		t.Fatalf("observed false positive rate %f exceeds %f", observed, fpr)
+	}
+}
@@ -0,0 +1,57 @@
+package DBF
+
+import (
+	"bytes"
+	"crypto/sha512"
+	"encoding/binary"
+	"sort"
+)
+
+// seedLabelPrefix separates seeds derived from labels from other uses of SHA-512/256
+const seedLabelPrefix = "DBF seed label:"
+
+// seedSharesPrefix separates seeds combined from shares from other uses of SHA-512/256
+const seedSharesPrefix = "DBF seed shares:"
+
+// SeedFromLabel derives a 32 byte seed from a human readable label, so that peers agreeing on the label
+// get identical seeds. The seed is SHA-512/256 of "DBF seed label:" followed by the UTF-8 bytes of label.
+func SeedFromLabel(label string) []byte {
+	seed := sha512.Sum512_256([]byte(seedLabelPrefix + label))
+	return seed[:]
+}
+
+// CombineSeedShares combines the seed shares contributed by several parties into a 32 byte seed that depends
+// on every share. It is SHA-512/256 of "DBF seed shares:" followed by the shares sorted bytewise, each prefixed
+// with its 4 byte big endian length, so every party has to combine the same shares, in any order, to get the
+// same seed. Unlike an XOR of the shares, equal shares do not cancel and no share can be chosen to cancel the
+// others. A party that sees the other shares before picking its own can still try shares until it likes the
+// seed, so parties should commit to their shares, for example by publishing their hashes, before revealing them.
+func CombineSeedShares(shares ...[]byte) []byte {
+	sorted := append([][]byte(nil), shares...)
+	sort.Slice(sorted, func(i, j int) bool { return bytes.Compare(sorted[i], sorted[j]) < 0 })
+	h := sha512.New512_256()
+	h.Write([]byte(seedSharesPrefix))
+	var length [4]byte
+	for _, share := range sorted {
+		binary.BigEndian.PutUint32(length[:], uint32(len(share)))
+		h.Write(length[:])
+		h.Write(share)
+	}
+	return h.Sum(nil)
+}
+
+// SeedFingerprint returns SHA-512/256 of the seed, it identifies the seed without revealing it and is safe to log
+func (dbf *DistBF) SeedFingerprint() [32]byte {
+	return sha512.Sum512_256(dbf.s)
+}
+
+// SeedHashes returns a copy of the k seed hashes the indices of DBF are derived from, so a verifier can
+// recompute them from the agreed seed. They are as wide as the hash function, 32 bytes for SHA-512/256.
+func (dbf *DistBF) SeedHashes() [][]byte {
+	h := dbf.hashes()
+	ret := make([][]byte, len(h))
+	for i := range h {
+		ret[i] = append([]byte(nil), h[i]...)
+	}
+	return ret
+}
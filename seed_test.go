@@ -0,0 +1,77 @@
+package DBF
+
+import (
+	"bytes"
+	"crypto/sha512"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSeedFromLabel(t *testing.T) {
+	// the seed must never change, otherwise peers running different versions get different seeds
+	want := []byte{0x7d, 0x7e, 0x15, 0x11, 0x28, 0xdb, 0x4a, 0x3f, 0xfb, 0x35, 0x90, 0x94, 0xc1, 0xa4, 0x1e, 0x18,
+		0x83, 0xe2, 0x67, 0x98, 0x4b, 0xce, 0x30, 0x95, 0x65, 0x33, 0x32, 0xbe, 0x93, 0x65, 0x8f, 0x9d}
+	assert.Equal(t, want, SeedFromLabel("customer-emails-v2"))
+	if bytes.Equal(SeedFromLabel("customer-emails-v2"), SeedFromLabel("customer-emails-v3")) {
+		t.Fatal("different labels should give different seeds")
+	}
+}
+
+func TestSeedFingerprint(t *testing.T) {
+	dbf := NewDbf(100, 0.1, []byte("seed"))
+	other := NewDbf(100, 0.1, []byte("other seed"))
+	if dbf.SeedFingerprint() != NewDbf(10, 0.5, []byte("seed")).SeedFingerprint() {
+		t.Fatal("dbfs with the same seed should have the same fingerprint")
+	}
+	if dbf.SeedFingerprint() == other.SeedFingerprint() {
+		t.Fatal("dbfs with different seeds should have different fingerprints")
+	}
+	err := dbf.Union(other)
+	if err == nil {
+		t.Fatal("union of dbfs with different seeds should fail")
+	}
+	assert.Contains(t, err.Error(), "seed fingerprints differ")
+}
+
+func TestDistBFSeedHashes(t *testing.T) {
+	dbf := NewDbf(100, 0.1, []byte("seed"))
+	hashes := dbf.SeedHashes()
+	assert.Equal(t, seedHashes(sha512.New512_256, []byte("seed"), dbf.k), hashes)
+	for _, h := range hashes {
+		assert.Len(t, h, sha512.Size256)
+	}
+	hashes[0][0] ^= 0xff
+	if bytes.Equal(hashes[0], dbf.h[0]) {
+		t.Fatal("modifying the returned seed hashes should not change the dbf")
+	}
+	lazy := NewDbfWithOptions(100, 0.1, WithSeed([]byte("seed")), WithLazySeedHashes())
+	assert.Equal(t, dbf.SeedHashes(), lazy.SeedHashes())
+}
+
+func TestCombineSeedShares(t *testing.T) {
+	a, b, c := []byte("share of a"), []byte("share of b"), []byte("share of c")
+	seed := CombineSeedShares(a, b, c)
+	assert.Equal(t, 32, len(seed))
+	for _, order := range [][][]byte{{a, c, b}, {b, a, c}, {b, c, a}, {c, a, b}, {c, b, a}} {
+		assert.Equal(t, seed, CombineSeedShares(order...), "the order of the shares should not matter")
+	}
+	different := [][]byte{
+		CombineSeedShares(a, b),
+		CombineSeedShares(a, b, []byte("other share of c")),
+		CombineSeedShares(a, b, c, c),
+		// the length prefixes keep share boundaries apart
+		CombineSeedShares([]byte("share of ashare of b"), c),
+	}
+	for _, other := range different {
+		if bytes.Equal(seed, other) {
+			t.Fatal("different shares should give different seeds")
+		}
+	}
+	if bytes.Equal(CombineSeedShares(a, a), CombineSeedShares(b, b)) {
+		t.Fatal("equal shares should not cancel out")
+	}
+	if !NewDbf(100, 0.1, seed).Compatible(NewDbf(100, 0.1, CombineSeedShares(c, b, a))) {
+		t.Fatal("dbfs from the same shares should be compatible")
+	}
+}
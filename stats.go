@@ -0,0 +1,59 @@
+package DBF
+
+import "sync/atomic"
+
+// Stats is a snapshot of the usage and health of a DBF. Adds and Queries count the elements added and
+// queried since the DBF was created, they are 0 unless it was created with WithStats. Every method testing
+// the membership of an element in the DBF counts as a query, the Contains methods as well as ContainsDebug,
+// Membership, VerifyElement and Proof.
+type Stats struct {
+	Adds         uint64
+	Queries      uint64
+	SetBits      uint
+	EstimatedFPR float64
+	FillRatio    float64
+}
+
+// statsCounters are the counters of WithStats, updated atomically since queries run concurrently under
+// the read lock of ConcurrentDistBF and AtomicDistBF adds without a lock
+type statsCounters struct {
+	adds    uint64
+	queries uint64
+}
+
+// WithStats counts the elements added and queried, reported by Stats. Without it counting costs a nil check.
+func WithStats() Option {
+	return func(dbf *DistBF) {
+		dbf.stats = new(statsCounters)
+	}
+}
+
+// Stats returns the counters of WithStats and the current set bits, estimated false positive rate and
+// fill ratio of DBF
+func (dbf *DistBF) Stats() Stats {
+	setBits := dbf.Count()
+	s := Stats{
+		SetBits:      setBits,
+		EstimatedFPR: dbf.EstimatedFPR(),
+		FillRatio:    float64(setBits) / float64(dbf.m),
+	}
+	if dbf.stats != nil {
+		s.Adds = atomic.LoadUint64(&dbf.stats.adds)
+		s.Queries = atomic.LoadUint64(&dbf.stats.queries)
+	}
+	return s
+}
+
+// countAdds adds n to the added elements of WithStats
+func (dbf *DistBF) countAdds(n int) {
+	if dbf.stats != nil {
+		atomic.AddUint64(&dbf.stats.adds, uint64(n))
+	}
+}
+
+// countQueries adds n to the queried elements of WithStats
+func (dbf *DistBF) countQueries(n int) {
+	if dbf.stats != nil {
+		atomic.AddUint64(&dbf.stats.queries, uint64(n))
+	}
+}
@@ -0,0 +1,60 @@
+package DBF
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStats(t *testing.T) {
+	dbf := NewDbfWithOptions(1000, 0.01, WithSeed([]byte("seed")), WithStats())
+	elements := batchElements(100)
+	for _, elem := range elements[:50] {
+		dbf.Add(elem)
+	}
+	dbf.AddBatch(elements[50:])
+	dbf.AddString("something")
+	dbf.Contains(elements[0])
+	dbf.ContainsString("something")
+	dbf.ContainsBatch(elements[:10])
+	dbf.ContainsConstantTime(elements[0])
+	dbf.ContainsDebug(elements[0])
+	dbf.Membership(elements[0])
+	dbf.VerifyElement(elements[0])
+	dbf.Proof(elements[0])
+	s := dbf.Stats()
+	assert.Equal(t, uint64(101), s.Adds)
+	assert.Equal(t, uint64(17), s.Queries)
+	assert.Equal(t, dbf.Count(), s.SetBits)
+	assert.Equal(t, dbf.EstimatedFPR(), s.EstimatedFPR)
+	assert.Equal(t, dbf.FillRatio(), s.FillRatio)
+
+	clone := dbf.Clone()
+	clone.Add([]byte("clone only"))
+	assert.Equal(t, uint64(1), clone.Stats().Adds)
+	assert.Equal(t, uint64(101), dbf.Stats().Adds)
+
+	// run with -race to detect unsynchronized counters
+	c := NewConcurrentDbf(dbf)
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for _, elem := range elements {
+				c.Contains(elem)
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, uint64(17+4*len(elements)), dbf.Stats().Queries)
+
+	plain := NewDbf(1000, 0.01, []byte("seed"))
+	plain.Add([]byte("something"))
+	plain.Contains([]byte("something"))
+	s = plain.Stats()
+	if s.Adds != 0 || s.Queries != 0 || s.SetBits != plain.Count() {
+		t.Fatalf("without WithStats only the bit stats should be reported, got %+v", s)
+	}
+}
@@ -0,0 +1,48 @@
+package DBF
+
+import "github.com/willf/bitset"
+
+// The summary set by WithSummary is a small bit array with one bit per added element, at its hash modulo the
+// summary size. Contains checks it before computing the k indices, an unset bit means the element was
+// definitely not added. Only the methods that add elements know their hashes, so methods that set bits
+// without them, like SetIndices, OrWords or decoding, drop the summary until the DBF is cleared, and
+// Contains then checks the k indices only. The summary never turns a present element into a negative.
+
+// resetSummary empties the summary, or restores it after it was dropped
+func (dbf *DistBF) resetSummary() {
+	if dbf.summaryBits == 0 {
+		return
+	}
+	if dbf.summary == nil {
+		dbf.summary = bitset.New(dbf.summaryBits)
+		return
+	}
+	dbf.summary.ClearAll()
+}
+
+// dropSummary stops using the summary until resetSummary, for when bits were set without their elements
+func (dbf *DistBF) dropSummary() {
+	dbf.summary = nil
+	dbf.forgetSetBits()
+}
+
+// summaryIndex returns the summary bit of the element with the given hash. It reads the last 8 bytes of
+// digests long enough that they do not overlap the bytes the indices are computed from.
+func (dbf *DistBF) summaryIndex(digest []byte) uint {
+	if len(digest) >= 16 {
+		digest = digest[len(digest)-8:]
+	}
+	return byteModuloM(dbf.summaryBits, digest)
+}
+
+// addSummary sets the summary bit of the element with the given hash
+func (dbf *DistBF) addSummary(digest []byte) {
+	if dbf.summary != nil {
+		dbf.summary.Set(dbf.summaryIndex(digest))
+	}
+}
+
+// summaryExcludes returns true if the summary shows that the element with the given hash was not added
+func (dbf *DistBF) summaryExcludes(digest []byte) bool {
+	return dbf.summary != nil && !dbf.summary.Test(dbf.summaryIndex(digest))
+}
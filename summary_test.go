@@ -0,0 +1,129 @@
+package DBF
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestWithSummary(t *testing.T) {
+	plain := NewDbf(1000, 0.01, []byte("seed"))
+	dbf := NewDbfWithOptions(1000, 0.01, WithSeed([]byte("seed")), WithSummary(8000))
+	elements := batchElements(1000)
+	for i, elem := range elements {
+		switch i % 3 {
+		case 0:
+			dbf.Add(elem)
+		case 1:
+			dbf.AddString(string(elem))
+		default:
+			dbf.AddBatch([][]byte{elem})
+		}
+		plain.Add(elem)
+	}
+	if !dbf.b.Equal(plain.b) {
+		t.Fatal("the summary should not change the bits that are set")
+	}
+	for _, elem := range elements {
+		if !dbf.Contains(elem) || !dbf.ContainsString(string(elem)) {
+			t.Fatal("added element should be contained in dbf")
+		}
+	}
+	excluded := 0
+	for i := 0; i < 1000; i++ {
+		elem := []byte(fmt.Sprintf("absent-%d", i))
+		if dbf.summaryExcludes(hashElement(dbf.hashFunc(), elem)) {
+			excluded++
+			if dbf.Contains(elem) {
+				t.Fatal("an element excluded by the summary should not be contained")
+			}
+		}
+	}
+	// about exp(-1000/8000) of the absent elements have an unset summary bit
+	if excluded < 800 {
+		t.Fatalf("the summary should exclude most absent elements, excluded %d", excluded)
+	}
+
+	clone := dbf.Clone()
+	clone.Add([]byte("clone only"))
+	if !clone.Contains([]byte("clone only")) || clone.summary.Count() == dbf.summary.Count() {
+		t.Fatal("a clone should have its own summary")
+	}
+	grown, err := dbf.GrowBy(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, elem := range elements {
+		if !grown.Contains(elem) {
+			t.Fatal("a grown dbf should keep the summary of its elements")
+		}
+	}
+}
+
+func TestWithSummaryDropped(t *testing.T) {
+	element := []byte("something")
+	source := NewDbf(1000, 0.01, []byte("seed"))
+	source.Add(element)
+	indices := make([]int, 0, source.k)
+	for _, index := range source.GetElementIndices(element) {
+		indices = append(indices, int(index))
+	}
+	data, err := source.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	delta, err := source.DeltaFrom(NewDbf(1000, 0.01, []byte("seed")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	setters := map[string]func(dbf *DistBF) error{
+		"SetIndices": func(dbf *DistBF) error { dbf.SetIndices(indices); return nil },
+		"SetBitSet":  func(dbf *DistBF) error { dbf.SetBitSet(source.b.Clone()); return nil },
+		"BitArray": func(dbf *DistBF) error {
+			dbf.BitArray().InPlaceUnion(source.b)
+			return nil
+		},
+		"Union":           func(dbf *DistBF) error { return dbf.Union(source) },
+		"OrWords":         func(dbf *DistBF) error { return dbf.OrWords(source.Words()) },
+		"ApplyDelta":      func(dbf *DistBF) error { return dbf.ApplyDelta(delta) },
+		"UnmarshalBinary": func(dbf *DistBF) error { return dbf.UnmarshalBinary(data) },
+		"AddBatchParallel": func(dbf *DistBF) error {
+			dbf.AddBatchParallel([][]byte{element}, 2)
+			return nil
+		},
+	}
+	for name, set := range setters {
+		dbf := NewDbfWithOptions(1000, 0.01, WithSeed([]byte("seed")), WithSummary(8000))
+		if err := set(dbf); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if !dbf.Contains(element) {
+			t.Fatalf("%s: the summary should not hide elements whose bits were set directly", name)
+		}
+		dbf.Clear()
+		if dbf.Contains(element) || dbf.summary == nil {
+			t.Fatalf("%s: clearing should restore the summary", name)
+		}
+	}
+}
+
+func benchmarkContainsAbsent(b *testing.B, opts ...Option) {
+	dbf := NewDbfWithOptions(10000, 0.01, append([]Option{WithSeed([]byte("seed"))}, opts...)...)
+	dbf.AddBatch(batchElements(10000))
+	absent := make([][]byte, 10000)
+	for i := range absent {
+		absent[i] = []byte(fmt.Sprintf("absent-%d", i))
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		dbf.Contains(absent[i%len(absent)])
+	}
+}
+
+func BenchmarkContainsAbsent(b *testing.B) {
+	benchmarkContainsAbsent(b)
+}
+
+func BenchmarkContainsAbsentSummary(b *testing.B) {
+	benchmarkContainsAbsent(b, WithSummary(80000))
+}
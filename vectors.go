@@ -0,0 +1,26 @@
+package DBF
+
+import (
+	"crypto/sha512"
+	"sort"
+)
+
+// TestVectors returns the canonical indices of each element in a DBF with m bits, k hashes and seed s and no
+// options, ascending and without duplicates, keyed by the element as a string. They are the reference for
+// checking other implementations against this one.
+func TestVectors(m, k uint, s []byte, elements [][]byte) map[string][]uint {
+	h := seedHashes(sha512.New512_256, s, k)
+	vectors := make(map[string][]uint, len(elements))
+	for _, element := range elements {
+		indices := hashesModulo(m, addElementHash(sha512.New512_256, element, h))
+		sort.Slice(indices, func(i, j int) bool { return indices[i] < indices[j] })
+		canonical := indices[:0]
+		for i, index := range indices {
+			if i == 0 || index != indices[i-1] {
+				canonical = append(canonical, index)
+			}
+		}
+		vectors[string(element)] = canonical
+	}
+	return vectors
+}
@@ -0,0 +1,32 @@
+package DBF
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTestVectors(t *testing.T) {
+	// the vectors must never change, otherwise other implementations checked against them stop matching
+	want := map[string][]uint{
+		"":                 {171, 287, 352, 442, 550, 896, 969},
+		"a":                {137, 225, 255, 534, 627, 722, 936},
+		"hello world":      {160, 214, 295, 302, 508, 649, 813},
+		"\x00\x01\x02\xff": {213, 467, 506, 535, 542, 693, 956},
+	}
+	var elements [][]byte
+	for element := range want {
+		elements = append(elements, []byte(element))
+	}
+	seed := []byte("DBF test vectors")
+	vectors := TestVectors(1000, 7, seed, elements)
+	assert.Equal(t, want, vectors)
+	dbf := NewDbfWithParams(1000, 7, seed)
+	for _, element := range elements {
+		indices := dbf.GetElementIndices(element)
+		sort.Slice(indices, func(i, j int) bool { return indices[i] < indices[j] })
+		assert.Equal(t, indices, vectors[string(element)])
+	}
+	assert.Equal(t, []uint{0}, TestVectors(1, 3, seed, [][]byte{[]byte("a")})["a"])
+}